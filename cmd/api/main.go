@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,7 +16,7 @@ func main() {
 	log := logger.NewLogger()
 	config := core.LoadConfig(log)
 
-	db, shutdownDB, err := core.NewDatabase(config.Database, *log)
+	db, shutdownDB, err := core.NewDatabase(config.Database, log)
 	if err != nil {
 		log.Fatal("Failed to initialize database: ", err)
 	}
@@ -25,6 +26,11 @@ func main() {
 		log.Fatal("Failed to initialize Redis: ", err)
 	}
 
+	mq, shutdownMQ, err := core.NewBroker(config, redisClient, log)
+	if err != nil {
+		log.Fatal("Failed to initialize broker: ", err)
+	}
+
 	httpServer, shutdownServer := core.NewServer(config, log)
 
 	// Start HTTP Server
@@ -35,12 +41,33 @@ func main() {
 	// wait till server starts
 	<-httpServer.Started
 
+	// Relay queued tasks to the broker
+	relay := internal.InitOutboxRelay(config, log, db, mq)
+	ctx, cancel := context.WithCancel(context.Background())
+	relayStopped := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(relayStopped)
+	}()
+
+	// Deliver job and task webhooks
+	dispatcher := internal.InitWebhookDispatcher(config, log, db)
+	dispatcherStopped := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(dispatcherStopped)
+	}()
+
 	// Graceful shutdown
 	shutdownChan := make(chan os.Signal, 1)
 	signal.Notify(shutdownChan, os.Interrupt, syscall.SIGTERM)
 
 	<-shutdownChan
 	shutdownServer()
+	cancel()
+	<-relayStopped
+	<-dispatcherStopped
+	shutdownMQ()
 	shutdownDB()
 	shutdownRedis()
 
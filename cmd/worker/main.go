@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal"
+)
+
+func main() {
+
+	log := logger.NewLogger()
+	config := core.LoadConfig(log)
+
+	db, shutdownDB, err := core.NewDatabase(config.Database, log)
+	if err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+
+	redisClient, shutdownRedis, err := core.NewRedis(config.Redis, log)
+	if err != nil {
+		log.Fatal("Failed to initialize Redis: ", err)
+	}
+
+	mq, shutdownMQ, err := core.NewBroker(config, redisClient, log)
+	if err != nil {
+		log.Fatal("Failed to initialize broker: ", err)
+	}
+
+	taskConsumer, taskCancellations := internal.InitWorker(config, log, db, redisClient, mq)
+
+	// Start consuming tasks
+	ctx, cancel := context.WithCancel(context.Background())
+	go taskCancellations.Run(ctx)
+
+	stopped := make(chan struct{})
+	go func() {
+		taskConsumer.Run(ctx)
+		close(stopped)
+	}()
+
+	// Graceful shutdown
+	shutdownChan := make(chan os.Signal, 1)
+	signal.Notify(shutdownChan, os.Interrupt, syscall.SIGTERM)
+
+	<-shutdownChan
+	log.Info("Shutting down worker...")
+	// Closing the broker first lets tasks in progress finish
+	shutdownMQ()
+	cancel()
+	<-stopped
+	shutdownDB()
+	shutdownRedis()
+
+	log.Info("Worker exited successfully.")
+}
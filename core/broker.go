@@ -0,0 +1,70 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/broker/rabbitmq"
+	"github.com/meraf00/swytch/core/broker/redisstream"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+// NewBroker connects the task transport selected by config.Broker.Backend.
+// The Redis backend reuses rdb.
+func NewBroker(config *AppConfig, rdb *redis.Client, log logger.Log) (broker.Broker, func(), error) {
+	switch config.Broker.Backend {
+	case BrokerRabbitMQ:
+		return NewRabbitMQ(config.RabbitMQ, config.Broker, log)
+	case BrokerRedis:
+		return NewRedisStreams(config.Broker, rdb, log)
+	default:
+		return nil, nil, fmt.Errorf("unknown broker backend %q", config.Broker.Backend)
+	}
+}
+
+func NewRabbitMQ(cfg RabbitMQConfig, brokerCfg BrokerConfig, log logger.Log) (*rabbitmq.Client, func(), error) {
+	client := rabbitmq.New(cfg.Addr, log.Named("rabbitmq"))
+
+	// Wait for the first connection before handing out the client
+	select {
+	case <-client.IsReady:
+	case <-time.After(30 * time.Second):
+		return nil, nil, errors.New("failed to connect to RabbitMQ: timed out")
+	}
+
+	log.Info("Connected to RabbitMQ.")
+
+	// Publishers and workers must declare task queues alike
+	client.SetDefaultRetryDelays(brokerCfg.RetryDelays)
+
+	shutdown := func() {
+		if err := client.Close(); err != nil {
+			log.Error("Failed to close RabbitMQ connection: ", err)
+		} else {
+			log.Info("RabbitMQ connection closed.")
+		}
+	}
+
+	return client, shutdown, nil
+}
+
+func NewRedisStreams(cfg BrokerConfig, rdb *redis.Client, log logger.Log) (*redisstream.Broker, func(), error) {
+	if cfg.ClaimIdle <= 0 {
+		return nil, nil, errors.New("broker claim idle time must be positive")
+	}
+
+	b := redisstream.New(rdb, cfg.ClaimIdle, log.Named("redis-streams"))
+	b.SetDefaultRetryDelays(cfg.RetryDelays)
+
+	log.Info("Using Redis Streams as task broker.")
+
+	// The Redis client itself is closed by its own shutdown
+	shutdown := func() {
+		_ = b.Close()
+	}
+
+	return b, shutdown, nil
+}
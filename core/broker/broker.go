@@ -0,0 +1,77 @@
+package broker
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrClosed = errors.New("broker closed")
+
+// Broker moves messages between the services publishing work and the
+// workers consuming it.
+type Broker interface {
+	// Publish hands msg to the broker for delivery to subscribers of queue.
+	// It returns once the broker has accepted the message.
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Subscribe passes messages of queue to handler until ctx is cancelled,
+	// which makes it return nil, or the broker is closed. It keeps
+	// consuming across reconnects and returns once its running handlers
+	// have finished.
+	Subscribe(ctx context.Context, queue string, handler Handler, opts SubscribeOptions) error
+	// Close stops subscriptions from taking new messages and waits for
+	// running handlers before disconnecting.
+	Close() error
+}
+
+type SubscribeOptions struct {
+	// Concurrency is how many handlers run at once, 1 if unset.
+	Concurrency int
+	// Prefetch is how many unacknowledged messages the broker hands out
+	// ahead of the handlers, Concurrency if unset. Brokers that fetch one
+	// message per handler ignore it.
+	Prefetch int
+}
+
+// WithDefaults fills in unset options.
+func (o SubscribeOptions) WithDefaults() SubscribeOptions {
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.Prefetch <= 0 {
+		o.Prefetch = o.Concurrency
+	}
+	return o
+}
+
+type Message struct {
+	Body    []byte
+	Headers map[string]any
+}
+
+// Handler processes a delivery and settles it by calling Ack or Nack.
+// Deliveries left unsettled when their subscription ends are redelivered.
+type Handler func(ctx context.Context, d Delivery)
+
+type Delivery struct {
+	Message
+	// Attempts counts how often the message was nacked before.
+	Attempts int
+	// RetriesLeft is how many more times Nack(true) hands the message back
+	// before it is dead-lettered instead, or negative if there is no limit.
+	RetriesLeft int
+	Acknowledger
+}
+
+// CanRetry reports whether Nack(true) redelivers the message.
+func (d Delivery) CanRetry() bool {
+	return d.RetriesLeft != 0
+}
+
+type Acknowledger interface {
+	// Ack marks the message as processed.
+	Ack() error
+	// Nack rejects the message. With requeue it is delivered again, possibly
+	// after a delay, as long as retries are left; otherwise it is
+	// dead-lettered.
+	Nack(requeue bool) error
+}
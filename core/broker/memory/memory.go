@@ -0,0 +1,290 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+
+	"github.com/meraf00/swytch/core/broker"
+)
+
+var errAlreadySettled = errors.New("delivery already acked or nacked")
+
+// Broker is an in-process broker.Broker. Messages live in memory only, so it
+// suits tests and single process setups. Nacked messages are redelivered
+// right away.
+type Broker struct {
+	mu      sync.Mutex
+	queues  map[string]*queue
+	retries int
+	done    chan struct{}
+	closed  bool
+
+	subscriptions sync.WaitGroup
+}
+
+type queue struct {
+	messages []*message
+	// ready is signalled whenever messages becomes non-empty
+	ready chan struct{}
+	dead  []broker.Message
+}
+
+type message struct {
+	broker.Message
+	attempts int
+}
+
+// New creates a broker that redelivers a nacked message up to retries times
+// before dead-lettering it. A negative retries never dead-letters on requeue.
+func New(retries int) *Broker {
+	return &Broker{
+		queues:  make(map[string]*queue),
+		retries: retries,
+		done:    make(chan struct{}),
+	}
+}
+
+func (b *Broker) Publish(ctx context.Context, name string, msg broker.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return broker.ErrClosed
+	}
+
+	b.push(name, &message{Message: broker.Message{
+		Body:    append([]byte(nil), msg.Body...),
+		Headers: maps.Clone(msg.Headers),
+	}})
+	return nil
+}
+
+// Subscribe runs opts.Concurrency handlers, each taking one message at a
+// time; Prefetch is ignored.
+func (b *Broker) Subscribe(ctx context.Context, name string, handler broker.Handler, opts broker.SubscribeOptions) error {
+	opts = opts.WithDefaults()
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return broker.ErrClosed
+	}
+	b.subscriptions.Add(1)
+	b.mu.Unlock()
+	defer b.subscriptions.Done()
+
+	errs := make(chan error, opts.Concurrency)
+	for range opts.Concurrency {
+		go func() {
+			errs <- b.consume(ctx, name, handler)
+		}()
+	}
+
+	var err error
+	for range opts.Concurrency {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// consume hands messages of queue to handler until ctx is cancelled or the
+// broker is closed.
+func (b *Broker) consume(ctx context.Context, name string, handler broker.Handler) error {
+	var unsettled []*acknowledger
+	defer func() {
+		b.requeue(name, unsettled)
+	}()
+
+	for {
+		m, err := b.next(ctx, name)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		a := &acknowledger{broker: b, queue: name, message: m}
+		unsettled = append(unsettled, a)
+		handler(ctx, broker.Delivery{
+			Message:      m.Message,
+			Attempts:     m.attempts,
+			RetriesLeft:  b.retriesLeft(m),
+			Acknowledger: a,
+		})
+
+		b.mu.Lock()
+		unsettled = deleteSettled(unsettled)
+		b.mu.Unlock()
+	}
+}
+
+// DeadLetters returns the messages of queue that were nacked without
+// requeue or ran out of retries.
+func (b *Broker) DeadLetters(name string) []broker.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]broker.Message(nil), b.queue(name).dead...)
+}
+
+// Len returns the number of messages waiting in queue.
+func (b *Broker) Len(name string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.queue(name).messages)
+}
+
+// Close stops subscriptions and waits for their running handlers.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+
+	if b.closed {
+		b.mu.Unlock()
+		return broker.ErrClosed
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+
+	// Running handlers may still settle their deliveries
+	b.subscriptions.Wait()
+	return nil
+}
+
+// next waits for the first message of queue and removes it.
+func (b *Broker) next(ctx context.Context, name string) (*message, error) {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return nil, broker.ErrClosed
+		}
+
+		q := b.queue(name)
+		if len(q.messages) > 0 {
+			m := q.messages[0]
+			q.messages = q.messages[1:]
+			if len(q.messages) > 0 {
+				// Wake the next subscriber for the rest
+				q.signal()
+			}
+			b.mu.Unlock()
+			return m, nil
+		}
+		ready := q.ready
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-b.done:
+			return nil, broker.ErrClosed
+		case <-ready:
+		}
+	}
+}
+
+// requeue puts back deliveries whose subscription ended before they were
+// settled, like a broker does when a consumer's channel closes.
+func (b *Broker) requeue(name string, unsettled []*acknowledger) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, a := range unsettled {
+		if !a.settled {
+			a.settled = true
+			b.push(name, a.message)
+		}
+	}
+}
+
+func (b *Broker) retriesLeft(m *message) int {
+	if b.retries < 0 {
+		return -1
+	}
+	return max(b.retries-m.attempts, 0)
+}
+
+// queue returns the named queue, creating it on first use. Must be called
+// with the lock held.
+func (b *Broker) queue(name string) *queue {
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{ready: make(chan struct{}, 1)}
+		b.queues[name] = q
+	}
+	return q
+}
+
+// push appends m to the named queue. Must be called with the lock held.
+func (b *Broker) push(name string, m *message) {
+	q := b.queue(name)
+	q.messages = append(q.messages, m)
+	q.signal()
+}
+
+func (q *queue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func deleteSettled(acks []*acknowledger) []*acknowledger {
+	n := 0
+	for _, a := range acks {
+		if !a.settled {
+			acks[n] = a
+			n++
+		}
+	}
+	return acks[:n]
+}
+
+type acknowledger struct {
+	broker  *Broker
+	queue   string
+	message *message
+	settled bool
+}
+
+func (a *acknowledger) Ack() error {
+	a.broker.mu.Lock()
+	defer a.broker.mu.Unlock()
+
+	if a.settled {
+		return errAlreadySettled
+	}
+	a.settled = true
+	return nil
+}
+
+func (a *acknowledger) Nack(requeue bool) error {
+	b := a.broker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if a.settled {
+		return errAlreadySettled
+	}
+	a.settled = true
+
+	if requeue && b.retriesLeft(a.message) != 0 {
+		b.push(a.queue, &message{Message: a.message.Message, attempts: a.message.attempts + 1})
+		return nil
+	}
+
+	q := b.queue(a.queue)
+	q.dead = append(q.dead, a.message.Message)
+	return nil
+}
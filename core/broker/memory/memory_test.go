@@ -0,0 +1,243 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+)
+
+// settle decides what the handler does with a delivery.
+type settle func(d broker.Delivery) error
+
+func ack(d broker.Delivery) error     { return d.Ack() }
+func requeue(d broker.Delivery) error { return d.Nack(true) }
+func reject(d broker.Delivery) error  { return d.Nack(false) }
+
+func TestSettlement(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		// settles is applied to the successive deliveries of one message
+		settles      []settle
+		wantAttempts []int
+		wantRetries  []int
+		wantDead     int
+	}{
+		{
+			name:         "ack",
+			retries:      3,
+			settles:      []settle{ack},
+			wantAttempts: []int{0},
+			wantRetries:  []int{3},
+		},
+		{
+			name:         "nack redelivers",
+			retries:      3,
+			settles:      []settle{requeue, requeue, ack},
+			wantAttempts: []int{0, 1, 2},
+			wantRetries:  []int{3, 2, 1},
+		},
+		{
+			name:         "nack without requeue dead-letters",
+			retries:      3,
+			settles:      []settle{reject},
+			wantAttempts: []int{0},
+			wantRetries:  []int{3},
+			wantDead:     1,
+		},
+		{
+			name:         "running out of retries dead-letters",
+			retries:      2,
+			settles:      []settle{requeue, requeue, requeue},
+			wantAttempts: []int{0, 1, 2},
+			wantRetries:  []int{2, 1, 0},
+			wantDead:     1,
+		},
+		{
+			name:         "no retries",
+			retries:      0,
+			settles:      []settle{requeue},
+			wantAttempts: []int{0},
+			wantRetries:  []int{0},
+			wantDead:     1,
+		},
+		{
+			name:         "unlimited retries",
+			retries:      -1,
+			settles:      []settle{requeue, requeue, requeue, ack},
+			wantAttempts: []int{0, 1, 2, 3},
+			wantRetries:  []int{-1, -1, -1, -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.retries)
+			defer b.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			publish(t, b, "q", "hello")
+
+			deliveries := make(chan broker.Delivery)
+			go b.Subscribe(ctx, "q", func(ctx context.Context, d broker.Delivery) {
+				deliveries <- d
+			}, broker.SubscribeOptions{})
+
+			for i, s := range tt.settles {
+				d := receive(t, deliveries)
+				if string(d.Body) != "hello" {
+					t.Fatalf("delivery %d body = %q", i, d.Body)
+				}
+				if d.Attempts != tt.wantAttempts[i] {
+					t.Errorf("delivery %d attempts = %d, want %d", i, d.Attempts, tt.wantAttempts[i])
+				}
+				if d.RetriesLeft != tt.wantRetries[i] {
+					t.Errorf("delivery %d retries left = %d, want %d", i, d.RetriesLeft, tt.wantRetries[i])
+				}
+				if err := s(d); err != nil {
+					t.Fatalf("settle delivery %d: %v", i, err)
+				}
+				if err := d.Ack(); err == nil {
+					t.Errorf("delivery %d settled twice", i)
+				}
+			}
+
+			select {
+			case d := <-deliveries:
+				t.Fatalf("unexpected delivery after %d attempts", d.Attempts)
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			if got := len(b.DeadLetters("q")); got != tt.wantDead {
+				t.Errorf("dead letters = %d, want %d", got, tt.wantDead)
+			}
+			if got := b.Len("q"); got != 0 {
+				t.Errorf("queue length = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestUnsettledRedelivered(t *testing.T) {
+	b := New(3)
+	defer b.Close()
+
+	publish(t, b, "q", "hello")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.Subscribe(ctx, "q", func(ctx context.Context, d broker.Delivery) {
+			// Leave the delivery unsettled and end the subscription
+			cancel()
+		}, broker.SubscribeOptions{})
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not end")
+	}
+
+	if got := b.Len("q"); got != 1 {
+		t.Fatalf("queue length = %d, want the unsettled message back", got)
+	}
+
+	deliveries := make(chan broker.Delivery)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go b.Subscribe(ctx, "q", func(ctx context.Context, d broker.Delivery) {
+		deliveries <- d
+	}, broker.SubscribeOptions{})
+
+	d := receive(t, deliveries)
+	if d.Attempts != 0 {
+		t.Errorf("attempts = %d, a redelivery after a lost consumer is not a retry", d.Attempts)
+	}
+	d.Ack()
+}
+
+func TestConcurrentHandlersShareQueue(t *testing.T) {
+	b := New(0)
+	defer b.Close()
+
+	const messages = 50
+	for range messages {
+		publish(t, b, "q", "m")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deliveries := make(chan broker.Delivery)
+	go b.Subscribe(ctx, "q", func(ctx context.Context, d broker.Delivery) {
+		deliveries <- d
+		d.Ack()
+	}, broker.SubscribeOptions{Concurrency: 4})
+
+	for range messages {
+		receive(t, deliveries)
+	}
+	if got := b.Len("q"); got != 0 {
+		t.Fatalf("queue length = %d, want 0", got)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := New(0)
+
+	done := make(chan error)
+	go func() {
+		done <- b.Subscribe(context.Background(), "q", func(ctx context.Context, d broker.Delivery) {}, broker.SubscribeOptions{})
+	}()
+
+	// Let the subscription start waiting
+	time.Sleep(10 * time.Millisecond)
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, broker.ErrClosed) {
+			t.Fatalf("Subscribe = %v, want ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscription did not end")
+	}
+
+	if err := b.Publish(context.Background(), "q", broker.Message{}); !errors.Is(err, broker.ErrClosed) {
+		t.Fatalf("Publish = %v, want ErrClosed", err)
+	}
+	if err := b.Close(); !errors.Is(err, broker.ErrClosed) {
+		t.Fatalf("second Close = %v, want ErrClosed", err)
+	}
+}
+
+func publish(t *testing.T, b *Broker, queue, body string) {
+	t.Helper()
+
+	if err := b.Publish(context.Background(), queue, broker.Message{Body: []byte(body)}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+}
+
+func receive(t *testing.T, deliveries <-chan broker.Delivery) broker.Delivery {
+	t.Helper()
+
+	select {
+	case d := <-deliveries:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+		return broker.Delivery{}
+	}
+}
@@ -0,0 +1,110 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// publishTimeout bounds PublishMessage when ctx has no deadline.
+const publishTimeout = 30 * time.Second
+
+var ErrNacked = errors.New("message rejected by the server")
+
+// Message is a message to publish, mirroring the amqp.Publishing fields
+// this client supports.
+type Message struct {
+	Body        []byte
+	ContentType string
+	Headers     amqp.Table
+	// MessageID defaults to a random UUID.
+	MessageID     string
+	CorrelationID string
+	// Priority only has an effect on queues declared with x-max-priority.
+	Priority uint8
+	// Expiration discards the message if it is not consumed in time. Zero
+	// keeps it until it is consumed.
+	Expiration time.Duration
+	// Transient messages are not written to disk, so they are lost when
+	// the broker restarts.
+	Transient bool
+}
+
+// PublishMessage publishes msg to exchange with routingKey and waits until
+// the server confirms it. It returns ErrNacked if the server rejects the
+// message, or the context error once ctx is done; without a deadline on
+// ctx it gives up after 30 seconds. While disconnected it keeps retrying
+// until then.
+func (client *Client) PublishMessage(ctx context.Context, exchange, routingKey string, msg Message) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+	}
+
+	publishing := msg.publishing()
+	for {
+		confirmation, err := client.publishDeferred(ctx, exchange, routingKey, publishing)
+		if err == nil {
+			acked, err := confirmation.WaitContext(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to confirm message %s: %w", publishing.MessageId, err)
+			}
+			if !acked {
+				return ErrNacked
+			}
+			return nil
+		}
+
+		client.logger.Infof("Publish failed: %v. Retrying...", err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to publish message %s: %w", publishing.MessageId, ctx.Err())
+		case <-client.done:
+			return errShutdown
+		case <-time.After(resendDelay):
+		}
+	}
+}
+
+func (client *Client) publishDeferred(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	client.m.Lock()
+	if !client.isReady {
+		client.m.Unlock()
+		return nil, errNotConnected
+	}
+	ch := client.publisher
+	client.m.Unlock()
+
+	return ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, msg)
+}
+
+func (msg Message) publishing() amqp.Publishing {
+	p := amqp.Publishing{
+		Headers:       msg.Headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		Priority:      msg.Priority,
+		CorrelationId: msg.CorrelationID,
+		MessageId:     msg.MessageID,
+		Timestamp:     time.Now(),
+		Body:          msg.Body,
+	}
+
+	if p.MessageId == "" {
+		p.MessageId = uuid.NewString()
+	}
+	if msg.Transient {
+		p.DeliveryMode = amqp.Transient
+	}
+	if msg.Expiration > 0 {
+		p.Expiration = strconv.FormatInt(msg.Expiration.Milliseconds(), 10)
+	}
+
+	return p
+}
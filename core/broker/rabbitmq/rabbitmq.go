@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/meraf00/swytch/core/broker"
 	"github.com/meraf00/swytch/core/lib/logger"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -15,18 +16,25 @@ import (
 // Client is the base struct for handling connection recovery, consumption and
 // publishing.
 type Client struct {
-	m                  *sync.Mutex
-	logger             logger.Log
-	connection         *amqp.Connection
-	notifyConnClose    chan *amqp.Error
-	done               chan bool
-	channels           map[string]*amqp.Channel
-	notifyChanClose    map[string]chan *amqp.Error
-	aggNotifyChanClose chan struct {
-		*amqp.Error
-		queue string
-	}
-	notifyConfirm map[string]chan amqp.Confirmation
+	m               *sync.Mutex
+	logger          logger.Log
+	connection      *amqp.Connection
+	notifyConnClose chan *amqp.Error
+	done            chan bool
+	// publisher declares exchanges and bindings and publishes messages
+	publisher *amqp.Channel
+	// channels consume the queue they are keyed by
+	channels map[string]*amqp.Channel
+	// notifyChanClose receives the name of a channel closed by an error
+	notifyChanClose chan string
+	exchanges       map[string]Exchange
+	queues          map[string]Queue
+	bindings        []Binding
+	retryDelays     map[string][]time.Duration
+	// defaultRetryDelays apply to queues added through AddQueue
+	defaultRetryDelays []time.Duration
+	// subscriptions counts running Subscribe calls for Close to wait on
+	subscriptions sync.WaitGroup
 	isReady       bool
 	IsReady       chan struct{}
 }
@@ -37,6 +45,8 @@ const (
 	reInitDelay = 2 * time.Second
 
 	resendDelay = 5 * time.Second
+
+	resubscribeDelay = 5 * time.Second
 )
 
 var (
@@ -45,6 +55,8 @@ var (
 	errShutdown      = errors.New("client is shutting down")
 )
 
+var _ broker.Broker = (*Client)(nil)
+
 // New creates a new consumer state instance, and automatically
 // attempts to connect to the server.
 func New(addr string, logger logger.Log) *Client {
@@ -54,8 +66,10 @@ func New(addr string, logger logger.Log) *Client {
 		done:            make(chan bool),
 		IsReady:         make(chan struct{}, 1),
 		channels:        make(map[string]*amqp.Channel),
-		notifyChanClose: make(map[string]chan *amqp.Error),
-		notifyConfirm:   make(map[string]chan amqp.Confirmation),
+		notifyChanClose: make(chan string, 1),
+		exchanges:       make(map[string]Exchange),
+		queues:          make(map[string]Queue),
+		retryDelays:     make(map[string][]time.Duration),
 	}
 	go client.handleReconnect(addr)
 	return &client
@@ -113,8 +127,8 @@ func (client *Client) connect(addr string) (*amqp.Connection, error) {
 	return conn, nil
 }
 
-// handleReInit will wait for a channel error
-// and then continuously attempt to re-initialize both channels
+// handleReInit will wait for a channel error and then continuously
+// attempt to re-initialize the channels and re-declare the topology.
 func (client *Client) handleReInit(conn *amqp.Connection) bool {
 	for {
 		client.m.Lock()
@@ -124,7 +138,7 @@ func (client *Client) handleReInit(conn *amqp.Connection) bool {
 		err := client.init(conn)
 
 		if err != nil {
-			client.logger.Info("Failed to initialize channel. Retrying...")
+			client.logger.Infof("Failed to initialize channels: %v. Retrying...", err)
 
 			select {
 			case <-client.done:
@@ -137,20 +151,9 @@ func (client *Client) handleReInit(conn *amqp.Connection) bool {
 			continue
 		}
 
-		for queue := range client.channels {
-			go func() {
-				err := <-client.notifyChanClose[queue]
-				if err != nil {
-					client.logger.Infof("Channel for queue %s closed. Re-running init...", queue)
-					client.aggNotifyChanClose <- struct {
-						*amqp.Error
-						queue string
-					}{err, queue}
-
-				}
-				close(client.aggNotifyChanClose)
-			}()
-		}
+		client.m.Lock()
+		notifyChanClose := client.notifyChanClose
+		client.m.Unlock()
 
 		select {
 		case <-client.done:
@@ -158,49 +161,54 @@ func (client *Client) handleReInit(conn *amqp.Connection) bool {
 		case <-client.notifyConnClose:
 			client.logger.Info("Connection closed. Reconnecting...")
 			return false
-		case <-client.aggNotifyChanClose:
-			client.logger.Info("Channel closed. Re-running init...")
+		case name := <-notifyChanClose:
+			client.logger.Infof("Channel %s closed. Re-running init...", name)
 		}
 	}
 }
 
-// init will initialize channel & declare queue
+// init will open the channels and declare the exchanges, queues and
+// bindings added so far.
 func (client *Client) init(conn *amqp.Connection) error {
-	channels := make(map[string]*amqp.Channel, len(client.channels))
+	client.m.Lock()
+	defer client.m.Unlock()
 
-	for queue := range client.channels {
-		ch, err := conn.Channel()
-		if err != nil {
+	publisher, err := openChannel(conn)
+	if err != nil {
+		return err
+	}
+
+	for _, exchange := range client.exchanges {
+		if err := exchange.declare(publisher); err != nil {
 			return err
 		}
+	}
 
-		err = ch.Confirm(false)
+	channels := make(map[string]*amqp.Channel, len(client.queues))
+	for name, queue := range client.queues {
+		ch, err := openChannel(conn)
 		if err != nil {
 			return err
 		}
 
-		_, err = ch.QueueDeclare(
-			queue,
-			true,
-			false,
-			false,
-			false,
-			nil,
-		)
-		if err != nil {
+		if err := queue.declare(ch); err != nil {
 			return err
 		}
-		channels[queue] = ch
+		channels[name] = ch
 	}
 
-	client.changeChannels(channels)
-	client.m.Lock()
+	for _, binding := range client.bindings {
+		if err := binding.declare(publisher); err != nil {
+			return err
+		}
+	}
+
+	client.changeChannels(publisher, channels)
 	client.isReady = true
 	select {
 	case client.IsReady <- struct{}{}:
 	default:
 	}
-	client.m.Unlock()
 
 	return nil
 }
@@ -209,53 +217,49 @@ func (client *Client) AddQueue(queue string) error {
 	client.m.Lock()
 	defer client.m.Unlock()
 
-	if _, exists := client.channels[queue]; exists {
-		return nil
+	if len(client.defaultRetryDelays) > 0 {
+		return client.addQueueWithRetry(queue, client.defaultRetryDelays)
 	}
+	return client.addQueue(Queue{Name: queue})
+}
 
-	ch, err := client.connection.Channel()
-	if err != nil {
-		return err
+// addQueue declares a durable queue on its own channel. The queue is kept
+// so it is declared identically after a reconnect, or on connect if the
+// client is not connected yet. Must be called with the lock held.
+func (client *Client) addQueue(queue Queue) error {
+	if _, exists := client.queues[queue.Name]; exists {
+		return nil
 	}
 
-	err = ch.Confirm(false)
-	if err != nil {
-		return err
-	}
+	if client.isReady {
+		ch, err := openChannel(client.connection)
+		if err != nil {
+			return err
+		}
 
-	client.channels[queue] = ch
+		if err := queue.declare(ch); err != nil {
+			return err
+		}
 
-	_, err = ch.QueueDeclare(
-		queue,
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+		client.channels[queue.Name] = ch
+		client.watchChannel(queue.Name, ch)
 	}
 
-	client.notifyChanClose[queue] = make(chan *amqp.Error, 1)
-	client.notifyConfirm[queue] = make(chan amqp.Confirmation, 1)
-	ch.NotifyClose(client.notifyChanClose[queue])
-	ch.NotifyPublish(client.notifyConfirm[queue])
+	client.queues[queue.Name] = queue
+	return nil
+}
 
-	go func() {
-		err := <-client.notifyChanClose[queue]
-		if err != nil {
-			client.logger.Infof("Channel for queue %s closed. Re-running init...", queue)
-			client.aggNotifyChanClose <- struct {
-				*amqp.Error
-				queue string
-			}{err, queue}
+func openChannel(conn *amqp.Connection) (*amqp.Channel, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
 
-		}
-		close(client.aggNotifyChanClose)
-	}()
+	if err := ch.Confirm(false); err != nil {
+		return nil, err
+	}
 
-	return nil
+	return ch, nil
 }
 
 // changeConnection takes a new connection to the queue,
@@ -266,48 +270,56 @@ func (client *Client) changeConnection(connection *amqp.Connection) {
 	client.connection.NotifyClose(client.notifyConnClose)
 }
 
-// changeChannel takes a new channels to the queues,
-// and updates the channel listeners to reflect this.
-func (client *Client) changeChannels(channels map[string]*amqp.Channel) {
+// changeChannels takes the new channels and updates the channel listeners
+// to reflect this. Channels left over from before a channel error are
+// closed, so their consumers move to the new ones. Must be called with the
+// lock held.
+func (client *Client) changeChannels(publisher *amqp.Channel, channels map[string]*amqp.Channel) {
+	if client.publisher != nil {
+		_ = client.publisher.Close()
+	}
+	for _, ch := range client.channels {
+		_ = ch.Close()
+	}
+
+	client.publisher = publisher
 	client.channels = channels
-	for queue := range client.channels {
-		client.notifyChanClose[queue] = make(chan *amqp.Error, 1)
-		client.notifyConfirm[queue] = make(chan amqp.Confirmation, 1)
-		client.channels[queue].NotifyClose(client.notifyChanClose[queue])
-		client.channels[queue].NotifyPublish(client.notifyConfirm[queue])
-	}
-	client.aggNotifyChanClose = make(chan struct {
-		*amqp.Error
-		queue string
-	})
-}
+	client.notifyChanClose = make(chan string, 1)
 
-// Publish will push data onto the queue, and wait for a confirmation.
-// This will block until the server sends a confirmation. Errors are
-// only returned if the push action itself fails, see UnsafePush.
-func (client *Client) Publish(exchange, queue string, data []byte) error {
-	client.m.Lock()
-	if !client.isReady {
-		client.m.Unlock()
-		return errors.New("failed to push: not connected")
+	client.watchChannel("publisher", publisher)
+	for name, ch := range channels {
+		client.watchChannel(name, ch)
 	}
-	client.m.Unlock()
-	for {
-		err := client.PublishNoConfirm(exchange, queue, data)
-		if err != nil {
-			client.logger.Info("Publish failed. Retrying...")
+}
+
+// watchChannel reports ch on notifyChanClose if it is closed by an error.
+// Only the first report is kept, one is enough to re-run init. Must be
+// called with the lock held.
+func (client *Client) watchChannel(name string, ch *amqp.Channel) {
+	closed := ch.NotifyClose(make(chan *amqp.Error, 1))
+	notify := client.notifyChanClose
+
+	go func() {
+		if err := <-closed; err != nil {
 			select {
-			case <-client.done:
-				return errShutdown
-			case <-time.After(resendDelay):
+			case notify <- name:
+			default:
 			}
-			continue
-		}
-		confirm := <-client.notifyConfirm[queue]
-		if confirm.Ack {
-			return nil
 		}
+	}()
+}
+
+// Publish will push msg onto the queue, declaring it if needed, as a
+// persistent message and wait for a confirmation, see PublishMessage.
+func (client *Client) Publish(ctx context.Context, queue string, msg broker.Message) error {
+	if err := client.AddQueue(queue); err != nil {
+		return err
 	}
+
+	return client.PublishMessage(ctx, "", queue, Message{
+		Headers: msg.Headers,
+		Body:    msg.Body,
+	})
 }
 
 // PublishNoConfirm will push to the queue without checking for
@@ -315,26 +327,31 @@ func (client *Client) Publish(exchange, queue string, data []byte) error {
 // No guarantees are provided for whether the server will
 // receive the message.
 func (client *Client) PublishNoConfirm(exchange, queue string, data []byte) error {
+	return client.publish(exchange, queue, amqp.Publishing{
+		ContentType: "text/plain",
+		Body:        data,
+	})
+}
+
+func (client *Client) publish(exchange, queue string, msg amqp.Publishing) error {
 	client.m.Lock()
 	if !client.isReady {
 		client.m.Unlock()
 		return errNotConnected
 	}
+	ch := client.publisher
 	client.m.Unlock()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	return client.channels[queue].PublishWithContext(
+	return ch.PublishWithContext(
 		ctx,
 		exchange,
 		queue,
 		false,
 		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        data,
-		},
+		msg,
 	)
 }
 
@@ -343,20 +360,24 @@ func (client *Client) PublishNoConfirm(exchange, queue string, data []byte) erro
 // successfully processed, or delivery.Nack when it fails.
 // Ignoring this will cause data to build up on the server.
 func (client *Client) Consume(queue string) (<-chan amqp.Delivery, error) {
+	return client.consume(queue, 1)
+}
+
+func (client *Client) consume(queue string, prefetch int) (<-chan amqp.Delivery, error) {
 	client.m.Lock()
 	if !client.isReady {
 		client.m.Unlock()
 		return nil, errNotConnected
 	}
+	ch, ok := client.channels[queue]
 	client.m.Unlock()
 
-	ch, ok := client.channels[queue]
 	if !ok {
 		return nil, fmt.Errorf("queue %s not found", queue)
 	}
 
 	if err := ch.Qos(
-		1,
+		prefetch,
 		0,
 		false,
 	); err != nil {
@@ -374,16 +395,113 @@ func (client *Client) Consume(queue string) (<-chan amqp.Delivery, error) {
 	)
 }
 
-// Close will cleanly shut down the channels and connection.
+// Subscribe consumes queue, declaring it if needed, and passes deliveries
+// to a pool of opts.Concurrency handlers until ctx is cancelled or the
+// client is closed. The delivery channel closes whenever the connection
+// drops, so Subscribe consumes again once the client has reconnected.
+func (client *Client) Subscribe(ctx context.Context, queue string, handler broker.Handler, opts broker.SubscribeOptions) error {
+	opts = opts.WithDefaults()
+
+	client.m.Lock()
+	select {
+	case <-client.done:
+		client.m.Unlock()
+		return broker.ErrClosed
+	default:
+	}
+	// Close waits for subscriptions added before it closed done
+	client.subscriptions.Add(1)
+	client.m.Unlock()
+	defer client.subscriptions.Done()
+
+	if err := client.AddQueue(queue); err != nil {
+		return err
+	}
+
+	for {
+		deliveries, err := client.consume(queue, opts.Prefetch)
+		if err != nil {
+			client.logger.Warnf("Failed to consume from %s: %v", queue, err)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-client.done:
+				return broker.ErrClosed
+			case <-client.IsReady:
+			case <-time.After(resubscribeDelay):
+			}
+			continue
+		}
+
+		client.logger.Infof("Consuming from %s with %d handlers", queue, opts.Concurrency)
+		client.drain(ctx, queue, deliveries, handler, opts.Concurrency)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-client.done:
+			return broker.ErrClosed
+		default:
+		}
+		client.logger.Infof("Delivery channel for %s closed.", queue)
+	}
+}
+
+// drain hands deliveries to concurrency handlers until the channel closes,
+// ctx is cancelled or the client is closed, and returns once the running
+// handlers have finished.
+func (client *Client) drain(ctx context.Context, queue string, deliveries <-chan amqp.Delivery, handler broker.Handler, concurrency int) {
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-client.done:
+					return
+				case d, ok := <-deliveries:
+					if !ok {
+						return
+					}
+					handler(ctx, client.delivery(queue, d))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Close will stop subscriptions, wait for their running handlers and then
+// cleanly shut down the channels and connection.
 func (client *Client) Close() error {
 	client.m.Lock()
+	select {
+	case <-client.done:
+		client.m.Unlock()
+		return errAlreadyClosed
+	default:
+	}
+	close(client.done)
+	client.m.Unlock()
 
+	// Handlers may still ack or retry their deliveries
+	client.subscriptions.Wait()
+
+	client.m.Lock()
 	defer client.m.Unlock()
 
 	if !client.isReady {
 		return errAlreadyClosed
 	}
-	close(client.done)
+
+	if err := client.publisher.Close(); err != nil {
+		return err
+	}
 
 	for _, ch := range client.channels {
 		err := ch.Close()
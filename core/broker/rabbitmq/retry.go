@@ -0,0 +1,211 @@
+package rabbitmq
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// AttemptsHeader counts how often a message was retried.
+const AttemptsHeader = "x-attempts"
+
+// AddQueueWithRetry declares queue together with one delay queue per entry
+// of delays and a dead-letter queue. Messages handed to Retry wait in the
+// delay queue matching their attempt until their TTL expires and they are
+// dead-lettered back into queue; once every delay is used up they are moved
+// to the dead-letter queue instead.
+func (client *Client) AddQueueWithRetry(queue string, delays []time.Duration) error {
+	client.m.Lock()
+	defer client.m.Unlock()
+
+	return client.addQueueWithRetry(queue, delays)
+}
+
+// SetDefaultRetryDelays makes AddQueue, and so Publish and Subscribe,
+// declare queues with the given delay tiers as AddQueueWithRetry does.
+func (client *Client) SetDefaultRetryDelays(delays []time.Duration) {
+	client.m.Lock()
+	defer client.m.Unlock()
+
+	client.defaultRetryDelays = delays
+}
+
+// addQueueWithRetry must be called with the lock held.
+func (client *Client) addQueueWithRetry(queue string, delays []time.Duration) error {
+	if err := client.addQueue(Queue{Name: queue}); err != nil {
+		return err
+	}
+
+	for _, delay := range delays {
+		err := client.addQueue(Queue{
+			Name: RetryQueue(queue, delay),
+			Args: amqp.Table{
+				"x-message-ttl":             delay.Milliseconds(),
+				"x-dead-letter-exchange":    "",
+				"x-dead-letter-routing-key": queue,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := client.addQueue(Queue{Name: DeadLetterQueue(queue)}); err != nil {
+		return err
+	}
+
+	client.retryDelays[queue] = delays
+	return nil
+}
+
+// RetryQueue names the queue holding messages of queue for delay, e.g.
+// "tasks.retry.10s".
+func RetryQueue(queue string, delay time.Duration) string {
+	return queue + ".retry." + formatDelay(delay)
+}
+
+// DeadLetterQueue names the queue collecting messages of queue that ran out
+// of retries.
+func DeadLetterQueue(queue string) string {
+	return queue + ".dead"
+}
+
+// formatDelay drops the zero units time.Duration prints, so one minute
+// reads "1m" rather than "1m0s".
+func formatDelay(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// Attempts returns how often the delivery was retried, 0 on first delivery.
+func Attempts(d amqp.Delivery) int {
+	switch n := d.Headers[AttemptsHeader].(type) {
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// RetriesLeft returns how many more times a delivery from queue can be
+// retried before it is dead-lettered, or -1 if queue has no retry policy and
+// requeues without limit.
+func (client *Client) RetriesLeft(queue string, d amqp.Delivery) int {
+	client.m.Lock()
+	delays, ok := client.retryDelays[queue]
+	client.m.Unlock()
+
+	if !ok {
+		return -1
+	}
+	return max(len(delays)-Attempts(d), 0)
+}
+
+// Retry negatively acknowledges a delivery from queue by moving it into the
+// next delay tier, or into the dead-letter queue once the tiers are used up.
+// The copy carries the incremented attempt count; the original delivery is
+// acknowledged only after the copy is confirmed, so a failure leaves it to
+// be redelivered. Queues without a retry policy requeue the delivery
+// directly.
+func (client *Client) Retry(queue string, d amqp.Delivery) error {
+	client.m.Lock()
+	delays, ok := client.retryDelays[queue]
+	client.m.Unlock()
+
+	if !ok {
+		return d.Nack(false, true)
+	}
+
+	attempts := Attempts(d)
+	target := DeadLetterQueue(queue)
+	if attempts < len(delays) {
+		target = RetryQueue(queue, delays[attempts])
+	}
+
+	return client.moveDelivery(target, d, attempts+1)
+}
+
+// DeadLetter moves a delivery from queue into its dead-letter queue, or
+// discards it if queue has no retry policy.
+func (client *Client) DeadLetter(queue string, d amqp.Delivery) error {
+	client.m.Lock()
+	_, ok := client.retryDelays[queue]
+	client.m.Unlock()
+
+	if !ok {
+		return d.Nack(false, false)
+	}
+
+	return client.moveDelivery(DeadLetterQueue(queue), d, Attempts(d))
+}
+
+func (client *Client) moveDelivery(target string, d amqp.Delivery, attempts int) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[AttemptsHeader] = int32(attempts)
+
+	err := client.PublishMessage(context.Background(), "", target, Message{
+		Body:          d.Body,
+		ContentType:   d.ContentType,
+		Headers:       headers,
+		MessageID:     d.MessageId,
+		CorrelationID: d.CorrelationId,
+		Priority:      d.Priority,
+	})
+	if err != nil {
+		return err
+	}
+
+	return d.Ack(false)
+}
+
+func (client *Client) delivery(queue string, d amqp.Delivery) broker.Delivery {
+	return broker.Delivery{
+		Message: broker.Message{
+			Body:    d.Body,
+			Headers: d.Headers,
+		},
+		Attempts:     Attempts(d),
+		RetriesLeft:  client.RetriesLeft(queue, d),
+		Acknowledger: &acknowledger{client: client, queue: queue, delivery: d},
+	}
+}
+
+// acknowledger settles deliveries through the retry policy of their queue.
+type acknowledger struct {
+	client   *Client
+	queue    string
+	delivery amqp.Delivery
+}
+
+func (a *acknowledger) Ack() error {
+	return a.delivery.Ack(false)
+}
+
+func (a *acknowledger) Nack(requeue bool) error {
+	var err error
+	if requeue {
+		err = a.client.Retry(a.queue, a.delivery)
+	} else {
+		err = a.client.DeadLetter(a.queue, a.delivery)
+	}
+	if err != nil {
+		// Hand the message back rather than leaving it unacknowledged
+		_ = a.delivery.Nack(false, true)
+	}
+	return err
+}
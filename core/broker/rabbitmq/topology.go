@@ -0,0 +1,156 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"slices"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology lists exchanges, queues and the bindings between them. Everything
+// declared is durable and declared again after every reconnect.
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+type Exchange struct {
+	Name string
+	// Kind is amqp.ExchangeDirect, amqp.ExchangeTopic or amqp.ExchangeFanout.
+	Kind string
+	Args amqp.Table
+}
+
+type Queue struct {
+	Name string
+	// Quorum declares a replicated quorum queue instead of a classic one.
+	Quorum bool
+	// MaxLength caps the number of ready messages, zero means no limit.
+	MaxLength int
+	// MaxPriority enables message priorities from 0 to MaxPriority.
+	MaxPriority uint8
+	// Args are passed on as further queue arguments.
+	Args amqp.Table
+}
+
+// Binding routes messages published to Exchange with a routing key matching
+// RoutingKey into Queue.
+type Binding struct {
+	Exchange   string
+	Queue      string
+	RoutingKey string
+	Args       amqp.Table
+}
+
+// Declare adds t to the client's topology. Exchanges and queues already
+// known by name are left as they are.
+func (client *Client) Declare(t Topology) error {
+	client.m.Lock()
+	defer client.m.Unlock()
+
+	for _, exchange := range t.Exchanges {
+		if _, exists := client.exchanges[exchange.Name]; exists {
+			continue
+		}
+
+		if client.isReady {
+			if err := exchange.declare(client.publisher); err != nil {
+				return err
+			}
+		}
+		client.exchanges[exchange.Name] = exchange
+	}
+
+	for _, queue := range t.Queues {
+		if err := client.addQueue(queue); err != nil {
+			return err
+		}
+	}
+
+	for _, binding := range t.Bindings {
+		if slices.ContainsFunc(client.bindings, binding.equal) {
+			continue
+		}
+
+		if client.isReady {
+			if err := binding.declare(client.publisher); err != nil {
+				return err
+			}
+		}
+		client.bindings = append(client.bindings, binding)
+	}
+
+	return nil
+}
+
+func (e Exchange) declare(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		e.Name,
+		e.Kind,
+		true,
+		false,
+		false,
+		false,
+		e.Args,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare exchange %s: %w", e.Name, err)
+	}
+	return nil
+}
+
+func (q Queue) declare(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		q.Name,
+		true,
+		false,
+		false,
+		false,
+		q.arguments(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare queue %s: %w", q.Name, err)
+	}
+	return nil
+}
+
+func (q Queue) arguments() amqp.Table {
+	args := amqp.Table{}
+	for k, v := range q.Args {
+		args[k] = v
+	}
+
+	if q.Quorum {
+		args[amqp.QueueTypeArg] = amqp.QueueTypeQuorum
+	}
+	if q.MaxLength > 0 {
+		args[amqp.QueueMaxLenArg] = q.MaxLength
+	}
+	if q.MaxPriority > 0 {
+		args["x-max-priority"] = q.MaxPriority
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+func (b Binding) declare(ch *amqp.Channel) error {
+	err := ch.QueueBind(
+		b.Queue,
+		b.RoutingKey,
+		b.Exchange,
+		false,
+		b.Args,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to bind queue %s to %s: %w", b.Queue, b.Exchange, err)
+	}
+	return nil
+}
+
+func (b Binding) equal(other Binding) bool {
+	return b.Exchange == other.Exchange && b.Queue == other.Queue && b.RoutingKey == other.RoutingKey
+}
@@ -0,0 +1,464 @@
+package redisstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// group is the consumer group all workers of a queue share
+	group = "workers"
+
+	// messageField holds the encoded envelope of a stream entry
+	messageField = "message"
+
+	readBlock = time.Second
+
+	promoteBatch = 100
+)
+
+var _ broker.Broker = (*Broker)(nil)
+
+// Broker is a broker.Broker on Redis Streams. Each queue is a stream read
+// through a consumer group, so every message goes to one worker and stays
+// pending until it is acknowledged. Entries a crashed worker left pending
+// are taken over with XAUTOCLAIM once idle for claimIdle. Retries wait in a
+// sorted set per queue until their delay has passed.
+type Broker struct {
+	rdb       *redis.Client
+	log       logger.Log
+	consumer  string
+	claimIdle time.Duration
+
+	m           sync.Mutex
+	retryDelays map[string][]time.Duration
+	// defaultRetryDelays apply to queues not in retryDelays
+	defaultRetryDelays []time.Duration
+	groups             map[string]bool
+	done               chan struct{}
+	closed             bool
+
+	subscriptions sync.WaitGroup
+}
+
+// envelope is the stream entry of a message. RetryOf makes retried copies
+// of identical messages distinct members of the delay set.
+type envelope struct {
+	Body     []byte         `json:"body"`
+	Headers  map[string]any `json:"headers,omitempty"`
+	Attempts int            `json:"attempts"`
+	RetryOf  string         `json:"retry_of,omitempty"`
+}
+
+func New(rdb *redis.Client, claimIdle time.Duration, log logger.Log) *Broker {
+	return &Broker{
+		rdb:         rdb,
+		log:         log,
+		consumer:    consumerName(),
+		claimIdle:   claimIdle,
+		retryDelays: make(map[string][]time.Duration),
+		groups:      make(map[string]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// SetRetryDelays makes Nack(true) on deliveries from queue wait for each
+// of delays in turn before the message is redelivered; after the last one
+// it is dead-lettered. Queues without delays redeliver without limit.
+func (b *Broker) SetRetryDelays(queue string, delays []time.Duration) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.retryDelays[queue] = delays
+}
+
+// SetDefaultRetryDelays applies delays to every queue without delays of
+// its own, see SetRetryDelays.
+func (b *Broker) SetDefaultRetryDelays(delays []time.Duration) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.defaultRetryDelays = delays
+}
+
+// delays returns the retry delays of queue and whether it has any.
+func (b *Broker) delays(queue string) ([]time.Duration, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if delays, ok := b.retryDelays[queue]; ok {
+		return delays, true
+	}
+	return b.defaultRetryDelays, len(b.defaultRetryDelays) > 0
+}
+
+func (b *Broker) Publish(ctx context.Context, queue string, msg broker.Message) error {
+	if b.isClosed() {
+		return broker.ErrClosed
+	}
+
+	return b.add(ctx, b.rdb, queue, envelope{Body: msg.Body, Headers: msg.Headers})
+}
+
+// Subscribe runs opts.Concurrency handlers, each reading its own messages
+// from the consumer group; Prefetch is ignored.
+func (b *Broker) Subscribe(ctx context.Context, queue string, handler broker.Handler, opts broker.SubscribeOptions) error {
+	opts = opts.WithDefaults()
+
+	b.m.Lock()
+	if b.closed {
+		b.m.Unlock()
+		return broker.ErrClosed
+	}
+	b.subscriptions.Add(1)
+	b.m.Unlock()
+	defer b.subscriptions.Done()
+
+	if err := b.ensureGroup(ctx, queue); err != nil {
+		return err
+	}
+
+	errs := make(chan error, opts.Concurrency)
+	for range opts.Concurrency {
+		go func() {
+			errs <- b.consume(ctx, queue, handler)
+		}()
+	}
+
+	var err error
+	for range opts.Concurrency {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// consume reads, claims and handles messages of queue one at a time until
+// ctx is cancelled or the broker is closed.
+func (b *Broker) consume(ctx context.Context, queue string, handler broker.Handler) error {
+	lastClaim := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.done:
+			return broker.ErrClosed
+		default:
+		}
+
+		if err := b.promote(ctx, queue); err != nil && ctx.Err() == nil {
+			b.log.Warnf("Failed to promote delayed messages of %s: %v", queue, err)
+		}
+
+		var messages []redis.XMessage
+		var err error
+		// Claim one stale message at a time, as claimed entries count as
+		// delivered to this handler and would idle behind it otherwise.
+		// Keep claiming until none are left before throttling again.
+		if time.Since(lastClaim) >= b.claimIdle/2 {
+			messages, _, err = b.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   queue,
+				Group:    group,
+				Consumer: b.consumer,
+				MinIdle:  b.claimIdle,
+				Start:    "0-0",
+				Count:    1,
+			}).Result()
+			if len(messages) > 0 {
+				b.log.Infof("Claimed stale message %s from %s", messages[0].ID, queue)
+			} else {
+				lastClaim = time.Now()
+			}
+		}
+
+		if err == nil && len(messages) == 0 {
+			messages, err = b.read(ctx, queue)
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			b.log.Warnf("Failed to read from %s: %v", queue, err)
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-b.done:
+				return broker.ErrClosed
+			case <-time.After(readBlock):
+			}
+			continue
+		}
+
+		for _, m := range messages {
+			b.handle(ctx, queue, m, handler)
+		}
+	}
+}
+
+// Close stops subscriptions and waits for their running handlers. The
+// Redis client is shared and stays open.
+func (b *Broker) Close() error {
+	b.m.Lock()
+	if b.closed {
+		b.m.Unlock()
+		return broker.ErrClosed
+	}
+	b.closed = true
+	close(b.done)
+	b.m.Unlock()
+
+	b.subscriptions.Wait()
+	return nil
+}
+
+func (b *Broker) isClosed() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.closed
+}
+
+// ensureGroup creates the queue's stream and consumer group. The group
+// starts at the beginning so messages published before any worker ran are
+// not skipped.
+func (b *Broker) ensureGroup(ctx context.Context, queue string) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.groups[queue] {
+		return nil
+	}
+
+	err := b.rdb.XGroupCreateMkStream(ctx, queue, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group for %s: %w", queue, err)
+	}
+
+	b.groups[queue] = true
+	return nil
+}
+
+func (b *Broker) read(ctx context.Context, queue string) ([]redis.XMessage, error) {
+	streams, err := b.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: b.consumer,
+		Streams:  []string{queue, ">"},
+		Count:    1,
+		Block:    readBlock,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []redis.XMessage
+	for _, s := range streams {
+		messages = append(messages, s.Messages...)
+	}
+	return messages, nil
+}
+
+func (b *Broker) handle(ctx context.Context, queue string, m redis.XMessage, handler broker.Handler) {
+	raw, _ := m.Values[messageField].(string)
+
+	var env envelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		b.log.Errorf("Dead-lettering undecodable entry %s of %s: %v", m.ID, queue, err)
+		if err := b.settle(ctx, queue, m.ID, func(pipe redis.Pipeliner) {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: DeadLetterQueue(queue), Values: m.Values})
+		}); err != nil {
+			b.log.Errorf("Failed to dead-letter entry %s of %s: %v", m.ID, queue, err)
+		}
+		return
+	}
+
+	// Keep the entry from being claimed by others while the handler runs
+	stop := b.keepClaimed(ctx, queue, m.ID)
+	defer stop()
+
+	handler(ctx, broker.Delivery{
+		Message: broker.Message{
+			Body:    env.Body,
+			Headers: env.Headers,
+		},
+		Attempts:     env.Attempts,
+		RetriesLeft:  b.retriesLeft(queue, env.Attempts),
+		Acknowledger: &acknowledger{broker: b, queue: queue, id: m.ID, envelope: env},
+	})
+}
+
+// keepClaimed resets the idle time of a pending entry every so often, so
+// long running handlers are not mistaken for crashed ones.
+func (b *Broker) keepClaimed(ctx context.Context, queue, id string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(b.claimIdle / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := b.rdb.XClaimJustID(ctx, &redis.XClaimArgs{
+					Stream:   queue,
+					Group:    group,
+					Consumer: b.consumer,
+					Messages: []string{id},
+				}).Err()
+				if err != nil && ctx.Err() == nil {
+					b.log.Warnf("Failed to refresh claim on %s of %s: %v", id, queue, err)
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+func (b *Broker) retriesLeft(queue string, attempts int) int {
+	delays, ok := b.delays(queue)
+
+	if !ok {
+		return -1
+	}
+	return max(len(delays)-attempts, 0)
+}
+
+func (b *Broker) retryDelay(queue string, attempts int) (time.Duration, bool) {
+	delays, ok := b.delays(queue)
+
+	if !ok {
+		return 0, true
+	}
+	if attempts >= len(delays) {
+		return 0, false
+	}
+	return delays[attempts], true
+}
+
+func (b *Broker) add(ctx context.Context, c redis.Cmdable, queue string, env envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	return c.XAdd(ctx, &redis.XAddArgs{
+		Stream: queue,
+		Values: map[string]any{messageField: data},
+	}).Err()
+}
+
+// settle acknowledges and removes entry id of queue together with the
+// commands queued by fn, in one transaction.
+func (b *Broker) settle(ctx context.Context, queue, id string, fn func(pipe redis.Pipeliner)) error {
+	_, err := b.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if fn != nil {
+			fn(pipe)
+		}
+		pipe.XAck(ctx, queue, group, id)
+		pipe.XDel(ctx, queue, id)
+		return nil
+	})
+	return err
+}
+
+// promoteScript moves due members of a delay set back into their stream.
+var promoteScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, m in ipairs(due) do
+	redis.call('ZREM', KEYS[1], m)
+	redis.call('XADD', KEYS[2], '*', 'message', m)
+end
+return #due
+`)
+
+func (b *Broker) promote(ctx context.Context, queue string) error {
+	return promoteScript.Run(ctx, b.rdb,
+		[]string{DelayedQueue(queue), queue},
+		time.Now().UnixMilli(), promoteBatch,
+	).Err()
+}
+
+// DelayedQueue names the sorted set holding retries of queue, scored by
+// when they are due.
+func DelayedQueue(queue string) string {
+	return queue + ":delayed"
+}
+
+// DeadLetterQueue names the stream collecting messages of queue that ran
+// out of retries.
+func DeadLetterQueue(queue string) string {
+	return queue + ":dead"
+}
+
+// consumerName identifies this process within the consumer group.
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}
+
+type acknowledger struct {
+	broker   *Broker
+	queue    string
+	id       string
+	envelope envelope
+}
+
+func (a *acknowledger) Ack() error {
+	return a.broker.settle(context.Background(), a.queue, a.id, nil)
+}
+
+func (a *acknowledger) Nack(requeue bool) error {
+	ctx := context.Background()
+	b := a.broker
+
+	retry := a.envelope
+	retry.Attempts++
+	retry.RetryOf = a.id
+
+	if !requeue {
+		return b.settle(ctx, a.queue, a.id, func(pipe redis.Pipeliner) {
+			_ = b.add(ctx, pipe, DeadLetterQueue(a.queue), a.envelope)
+		})
+	}
+
+	delay, ok := b.retryDelay(a.queue, a.envelope.Attempts)
+	if !ok {
+		return b.settle(ctx, a.queue, a.id, func(pipe redis.Pipeliner) {
+			_ = b.add(ctx, pipe, DeadLetterQueue(a.queue), retry)
+		})
+	}
+
+	data, err := json.Marshal(retry)
+	if err != nil {
+		return err
+	}
+
+	return b.settle(ctx, a.queue, a.id, func(pipe redis.Pipeliner) {
+		pipe.ZAdd(ctx, DelayedQueue(a.queue), redis.Z{
+			Score:  float64(time.Now().Add(delay).UnixMilli()),
+			Member: data,
+		})
+	})
+}
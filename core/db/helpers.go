@@ -1,6 +1,10 @@
 package db
 
-import "github.com/jackc/pgx/v5/pgtype"
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
 
 func ToPGText(s string) pgtype.Text {
 	if s == "" {
@@ -15,3 +19,10 @@ func ToPGInt4(i int32) pgtype.Int4 {
 	}
 	return pgtype.Int4{Int32: i, Valid: true}
 }
+
+func ToPGTimestamptz(t time.Time) pgtype.Timestamptz {
+	if t.IsZero() {
+		return pgtype.Timestamptz{}
+	}
+	return pgtype.Timestamptz{Time: t, Valid: true}
+}
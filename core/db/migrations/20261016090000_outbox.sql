@@ -0,0 +1,13 @@
+-- Create "outbox_messages" table
+CREATE TABLE "outbox_messages" (
+  "id" bigserial NOT NULL,
+  "queue" character varying(255) NOT NULL,
+  "payload" jsonb NOT NULL,
+  "attempts" integer NOT NULL DEFAULT 0,
+  "last_error" text NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  "sent_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_outbox_messages_unsent" to table: "outbox_messages"
+CREATE INDEX "idx_outbox_messages_unsent" ON "outbox_messages" ("id") WHERE (sent_at IS NULL);
@@ -0,0 +1,2 @@
+-- Modify "tasks" table
+ALTER TABLE "tasks" ADD COLUMN "options" jsonb NOT NULL DEFAULT '{}';
@@ -0,0 +1,9 @@
+-- Create "task_inputs" table
+CREATE TABLE "task_inputs" (
+  "task_id" integer NOT NULL,
+  "file_id" integer NOT NULL,
+  "position" integer NOT NULL,
+  PRIMARY KEY ("task_id", "position"),
+  CONSTRAINT "task_inputs_file_id_fkey" FOREIGN KEY ("file_id") REFERENCES "files" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "task_inputs_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
@@ -0,0 +1,42 @@
+-- Create enum type "webhook_status"
+CREATE TYPE "webhook_status" AS ENUM ('pending', 'delivered', 'failed');
+-- Modify "jobs" table
+ALTER TABLE "jobs" ADD COLUMN "callback_url" text NULL, ADD COLUMN "callback_secret" text NULL;
+-- Create "webhook_deliveries" table
+CREATE TABLE "webhook_deliveries" (
+  "id" bigserial NOT NULL,
+  "job_id" integer NOT NULL,
+  "task_id" integer NULL,
+  "event" character varying(64) NOT NULL,
+  "payload" jsonb NOT NULL,
+  "status" "webhook_status" NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  "last_error" text NULL,
+  "delivered_at" timestamptz NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "webhook_deliveries_job_id_fkey" FOREIGN KEY ("job_id") REFERENCES "jobs" ("id") ON UPDATE NO ACTION ON DELETE CASCADE,
+  CONSTRAINT "webhook_deliveries_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create index "idx_webhook_deliveries_due" to table: "webhook_deliveries"
+CREATE INDEX "idx_webhook_deliveries_due" ON "webhook_deliveries" ("next_attempt_at") WHERE (status = 'pending'::webhook_status);
+-- Create index "idx_webhook_deliveries_job_event" to table: "webhook_deliveries"
+CREATE UNIQUE INDEX "idx_webhook_deliveries_job_event" ON "webhook_deliveries" ("job_id") WHERE (task_id IS NULL);
+-- Create index "idx_webhook_deliveries_job_id" to table: "webhook_deliveries"
+CREATE INDEX "idx_webhook_deliveries_job_id" ON "webhook_deliveries" ("job_id");
+-- Create "webhook_attempts" table
+CREATE TABLE "webhook_attempts" (
+  "id" bigserial NOT NULL,
+  "delivery_id" bigint NOT NULL,
+  "attempt" integer NOT NULL,
+  "status_code" integer NULL,
+  "error" text NULL,
+  "duration_ms" integer NOT NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "webhook_attempts_delivery_id_fkey" FOREIGN KEY ("delivery_id") REFERENCES "webhook_deliveries" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Create index "idx_webhook_attempts_delivery_id" to table: "webhook_attempts"
+CREATE INDEX "idx_webhook_attempts_delivery_id" ON "webhook_attempts" ("delivery_id");
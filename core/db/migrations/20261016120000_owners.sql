@@ -0,0 +1,8 @@
+-- Modify "files" table
+ALTER TABLE "files" ADD COLUMN "owner_id" character varying(255) NOT NULL DEFAULT '';
+-- Create index "idx_files_owner_id" to table: "files"
+CREATE INDEX "idx_files_owner_id" ON "files" ("owner_id");
+-- Modify "jobs" table
+ALTER TABLE "jobs" ADD COLUMN "owner_id" character varying(255) NOT NULL DEFAULT '';
+-- Create index "idx_jobs_owner_id" to table: "jobs"
+CREATE INDEX "idx_jobs_owner_id" ON "jobs" ("owner_id");
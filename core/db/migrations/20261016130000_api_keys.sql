@@ -0,0 +1,18 @@
+-- Create "api_keys" table
+CREATE TABLE "api_keys" (
+  "id" serial NOT NULL,
+  "owner_id" character varying(255) NOT NULL,
+  "name" character varying(255) NOT NULL,
+  "prefix" character varying(32) NOT NULL,
+  "key_hash" character varying(255) NOT NULL,
+  "scopes" text[] NOT NULL DEFAULT '{}',
+  "expires_at" timestamptz NULL,
+  "last_used_at" timestamptz NULL,
+  "revoked_at" timestamptz NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "api_keys_prefix_key" UNIQUE ("prefix")
+);
+-- Create index "idx_api_keys_owner_id" to table: "api_keys"
+CREATE INDEX "idx_api_keys_owner_id" ON "api_keys" ("owner_id");
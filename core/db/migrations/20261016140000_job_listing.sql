@@ -0,0 +1,4 @@
+-- Drop index "idx_jobs_owner_id" from table: "jobs"
+DROP INDEX "idx_jobs_owner_id";
+-- Create index "idx_jobs_owner_id_created_at" to table: "jobs"
+CREATE INDEX "idx_jobs_owner_id_created_at" ON "jobs" ("owner_id", "created_at", "id");
@@ -0,0 +1,2 @@
+-- Modify enum "task_status"
+ALTER TYPE "task_status" ADD VALUE 'cancelled';
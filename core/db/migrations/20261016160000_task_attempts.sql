@@ -0,0 +1,21 @@
+-- Modify "tasks" table
+ALTER TABLE "tasks" ADD COLUMN "attempts" integer NOT NULL DEFAULT 0;
+-- Create "task_attempts" table
+CREATE TABLE "task_attempts" (
+  "id" bigserial NOT NULL,
+  "task_id" integer NOT NULL,
+  "attempt" integer NOT NULL,
+  "worker_id" character varying(255) NOT NULL,
+  "status" "task_status" NOT NULL,
+  "error_message" text NULL,
+  "started_at" timestamptz NOT NULL,
+  "completed_at" timestamptz NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "task_attempts_task_id_attempt_key" UNIQUE ("task_id", "attempt"),
+  CONSTRAINT "task_attempts_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE
+);
+-- Drop index "idx_webhook_deliveries_job_event" from table: "webhook_deliveries"
+DROP INDEX "idx_webhook_deliveries_job_event";
+-- Create index "idx_webhook_deliveries_job_event" to table: "webhook_deliveries"
+CREATE UNIQUE INDEX "idx_webhook_deliveries_job_event" ON "webhook_deliveries" ("job_id", "event") WHERE (task_id IS NULL);
@@ -0,0 +1,4 @@
+-- Create enum type "job_priority"
+CREATE TYPE "job_priority" AS ENUM ('interactive', 'normal', 'bulk');
+-- Modify "jobs" table
+ALTER TABLE "jobs" ADD COLUMN "priority" "job_priority" NOT NULL DEFAULT 'normal';
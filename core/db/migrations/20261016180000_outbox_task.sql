@@ -0,0 +1,4 @@
+-- Modify "outbox_messages" table
+ALTER TABLE "outbox_messages" ADD COLUMN "task_id" integer NULL, ADD CONSTRAINT "outbox_messages_task_id_fkey" FOREIGN KEY ("task_id") REFERENCES "tasks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE;
+-- Create index "idx_outbox_messages_unsent_task_id" to table: "outbox_messages"
+CREATE INDEX "idx_outbox_messages_unsent_task_id" ON "outbox_messages" ("task_id") WHERE (sent_at IS NULL);
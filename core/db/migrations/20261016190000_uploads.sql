@@ -0,0 +1,8 @@
+-- Create "uploads" table
+CREATE TABLE "uploads" (
+  "object_name" uuid NOT NULL,
+  "owner_id" character varying(255) NOT NULL,
+  "original_name" character varying(255) NOT NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("object_name")
+);
@@ -0,0 +1,2 @@
+-- Modify "outbox_messages" table
+ALTER TABLE "outbox_messages" ADD COLUMN "priority" "job_priority" NOT NULL DEFAULT 'normal', ADD COLUMN "next_attempt_at" timestamptz NOT NULL DEFAULT CURRENT_TIMESTAMP;
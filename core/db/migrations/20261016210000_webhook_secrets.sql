@@ -0,0 +1,16 @@
+-- Create "webhook_secrets" table
+CREATE TABLE "webhook_secrets" (
+  "owner_id" character varying(255) NOT NULL,
+  "secret" text NOT NULL,
+  "created_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  "updated_at" timestamptz NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY ("owner_id")
+);
+-- Keep signing pending deliveries with each owner's most recent job secret
+INSERT INTO "webhook_secrets" ("owner_id", "secret")
+SELECT DISTINCT ON ("owner_id") "owner_id", "callback_secret"
+FROM "jobs"
+WHERE "callback_secret" IS NOT NULL
+ORDER BY "owner_id", "id" DESC;
+-- Modify "jobs" table
+ALTER TABLE "jobs" DROP COLUMN "callback_secret";
@@ -0,0 +1,8 @@
+-- Modify "jobs" table
+ALTER TABLE "jobs" ADD COLUMN "generation" integer NOT NULL DEFAULT 0;
+-- Modify "webhook_deliveries" table
+ALTER TABLE "webhook_deliveries" ADD COLUMN "generation" integer NOT NULL DEFAULT 0;
+-- Drop index "idx_webhook_deliveries_job_event" from table: "webhook_deliveries"
+DROP INDEX "idx_webhook_deliveries_job_event";
+-- Create index "idx_webhook_deliveries_job_event" to table: "webhook_deliveries"
+CREATE UNIQUE INDEX "idx_webhook_deliveries_job_event" ON "webhook_deliveries" ("job_id", "event", "generation") WHERE (task_id IS NULL);
@@ -0,0 +1,47 @@
+-- Create "job_summaries" view
+CREATE VIEW "job_summaries" AS SELECT
+    jobs.id,
+    jobs.created_at,
+    jobs.updated_at,
+    jobs.callback_url,
+    jobs.owner_id,
+    jobs.priority,
+    jobs.generation,
+    counts.total_tasks,
+    counts.pending_tasks,
+    counts.processing_tasks,
+    counts.completed_tasks,
+    counts.failed_tasks,
+    counts.cancelled_tasks,
+    counts.started_at,
+    summary.status,
+    summary.finished_at
+FROM jobs
+    CROSS JOIN LATERAL (
+        SELECT
+            COUNT(*)::int AS total_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'pending')::int AS pending_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'processing')::int AS processing_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'completed')::int AS completed_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'failed')::int AS failed_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'cancelled')::int AS cancelled_tasks,
+            MIN(tasks.started_at)::timestamptz AS started_at,
+            MAX(tasks.completed_at)::timestamptz AS last_completed_at
+        FROM tasks
+        WHERE tasks.job_id = jobs.id
+    ) counts
+    CROSS JOIN LATERAL (
+        -- Cancelled tasks do not count against the outcome of the others
+        SELECT CASE
+            WHEN counts.total_tasks = 0 THEN 'pending'
+            WHEN counts.pending_tasks > 0 AND counts.processing_tasks + counts.completed_tasks + counts.failed_tasks = 0 THEN 'pending'
+            WHEN counts.pending_tasks + counts.processing_tasks > 0 THEN 'running'
+            WHEN counts.cancelled_tasks = counts.total_tasks THEN 'cancelled'
+            WHEN counts.failed_tasks = 0 THEN 'completed'
+            WHEN counts.completed_tasks = 0 THEN 'failed'
+            ELSE 'partially_failed'
+        END::text AS status,
+        CASE
+            WHEN counts.total_tasks > 0 AND counts.pending_tasks + counts.processing_tasks = 0 THEN counts.last_completed_at
+        END::timestamptz AS finished_at
+    ) summary;
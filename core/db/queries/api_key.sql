@@ -0,0 +1,37 @@
+-- name: CreateApiKey :one
+INSERT INTO
+    api_keys (
+        owner_id,
+        name,
+        prefix,
+        key_hash,
+        scopes,
+        expires_at
+    )
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING
+    *;
+
+-- name: GetApiKeyByPrefix :one
+SELECT * FROM api_keys WHERE prefix = $1;
+
+-- name: GetApiKeysByOwnerID :many
+SELECT * FROM api_keys WHERE owner_id = $1 ORDER BY id;
+
+-- name: RevokeApiKey :one
+UPDATE api_keys
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP),
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND owner_id = $2
+RETURNING
+    *;
+
+-- name: TouchApiKey :exec
+UPDATE api_keys
+SET
+    last_used_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
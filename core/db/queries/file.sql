@@ -1,13 +1,14 @@
 -- name: GetFileByID :one
-SELECT * FROM files WHERE id = $1;
+SELECT * FROM files WHERE id = $1 AND owner_id = $2;
 
 -- name: CreateFile :one
 INSERT INTO
     files (
         object_name,
         original_name,
-        original_format
+        original_format,
+        owner_id
     )
-VALUES ($1, $2, $3)
+VALUES ($1, $2, $3, $4)
 RETURNING
-    *;
\ No newline at end of file
+    *;
@@ -1,10 +1,100 @@
 -- name: GetJobByID :one
 SELECT *
+FROM job_summaries
+WHERE id = $1 AND owner_id = $2;
+
+-- name: GetJobByIDForUpdate :one
+SELECT *
+FROM jobs
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetJobPriority :one
+SELECT priority
 FROM jobs
 WHERE id = $1;
 
+-- name: BumpJobGeneration :exec
+UPDATE jobs
+SET
+    generation = generation + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
 
 -- name: CreateJob :one
-INSERT INTO jobs DEFAULT
-VALUES
-RETURNING *;
\ No newline at end of file
+INSERT INTO
+    jobs (owner_id, callback_url, priority)
+VALUES ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: ListJobsNewestFirst :many
+SELECT job_summaries.*
+FROM (
+    -- The page is cut on jobs and their owner index, so only its jobs are
+    -- summarized. Status is derived from the summary: with a status filter,
+    -- jobs are summarized in page order until the page is full, which walks
+    -- all of the owner's jobs if few have that status.
+    SELECT id, created_at
+    FROM jobs
+    WHERE
+        owner_id = @owner_id
+        AND (sqlc.narg(created_after)::timestamptz IS NULL OR created_at >= sqlc.narg(created_after))
+        AND (sqlc.narg(created_before)::timestamptz IS NULL OR created_at < sqlc.narg(created_before))
+        AND (
+            sqlc.narg(file_name)::text IS NULL
+            OR EXISTS (
+                SELECT 1
+                FROM tasks
+                    JOIN files ON files.id = tasks.file_id
+                WHERE tasks.job_id = jobs.id
+                    AND files.original_name ILIKE '%' || sqlc.narg(file_name) || '%'
+            )
+        )
+        AND (
+            sqlc.narg(cursor_id)::int IS NULL
+            OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id))
+        )
+    ORDER BY created_at DESC, id DESC
+    LIMIT CASE WHEN sqlc.narg(status)::text IS NULL THEN @page_size::int END
+) page
+    JOIN job_summaries ON job_summaries.id = page.id
+WHERE sqlc.narg(status)::text IS NULL OR job_summaries.status = sqlc.narg(status)
+ORDER BY page.created_at DESC, page.id DESC
+LIMIT @page_size;
+
+-- name: ListJobsOldestFirst :many
+SELECT job_summaries.*
+FROM (
+    -- The page is cut on jobs and their owner index, so only its jobs are
+    -- summarized. Status is derived from the summary: with a status filter,
+    -- jobs are summarized in page order until the page is full, which walks
+    -- all of the owner's jobs if few have that status.
+    SELECT id, created_at
+    FROM jobs
+    WHERE
+        owner_id = @owner_id
+        AND (sqlc.narg(created_after)::timestamptz IS NULL OR created_at >= sqlc.narg(created_after))
+        AND (sqlc.narg(created_before)::timestamptz IS NULL OR created_at < sqlc.narg(created_before))
+        AND (
+            sqlc.narg(file_name)::text IS NULL
+            OR EXISTS (
+                SELECT 1
+                FROM tasks
+                    JOIN files ON files.id = tasks.file_id
+                WHERE tasks.job_id = jobs.id
+                    AND files.original_name ILIKE '%' || sqlc.narg(file_name) || '%'
+            )
+        )
+        AND (
+            sqlc.narg(cursor_id)::int IS NULL
+            OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamptz, sqlc.narg(cursor_id))
+        )
+    ORDER BY created_at ASC, id ASC
+    LIMIT CASE WHEN sqlc.narg(status)::text IS NULL THEN @page_size::int END
+) page
+    JOIN job_summaries ON job_summaries.id = page.id
+WHERE sqlc.narg(status)::text IS NULL OR job_summaries.status = sqlc.narg(status)
+ORDER BY page.created_at ASC, page.id ASC
+LIMIT @page_size;
@@ -0,0 +1,68 @@
+-- name: CreateOutboxMessage :one
+INSERT INTO
+    outbox_messages (queue, payload, task_id, priority)
+VALUES ($1, $2, $3, $4)
+RETURNING
+    *;
+
+-- name: GetUnsentOutboxMessages :many
+WITH in_flight AS (
+    -- Tasks handed to the broker and not finished yet
+    SELECT
+        jobs.owner_id,
+        COUNT(*)::int AS tasks
+    FROM tasks
+        JOIN jobs ON jobs.id = tasks.job_id
+    WHERE
+        tasks.status IN ('pending', 'processing')
+        AND NOT EXISTS (
+            SELECT 1
+            FROM outbox_messages
+            WHERE outbox_messages.task_id = tasks.id
+                AND outbox_messages.sent_at IS NULL
+        )
+    GROUP BY jobs.owner_id
+),
+turns AS (
+    SELECT
+        outbox_messages.id,
+        jobs.owner_id,
+        -- An owner's urgent tasks take its turns before its bulk ones
+        ROW_NUMBER() OVER (
+            PARTITION BY jobs.owner_id
+            ORDER BY outbox_messages.priority, outbox_messages.id
+        ) AS turn
+    FROM outbox_messages
+        LEFT JOIN tasks ON tasks.id = outbox_messages.task_id
+        LEFT JOIN jobs ON jobs.id = tasks.job_id
+    WHERE
+        outbox_messages.sent_at IS NULL
+        AND outbox_messages.next_attempt_at <= CURRENT_TIMESTAMP
+)
+SELECT outbox_messages.*
+FROM outbox_messages
+    JOIN turns ON turns.id = outbox_messages.id
+    LEFT JOIN in_flight ON in_flight.owner_id = turns.owner_id
+WHERE
+    @max_in_flight::int <= 0
+    OR turns.owner_id IS NULL
+    OR turns.turn + COALESCE(in_flight.tasks, 0) <= @max_in_flight::int
+ORDER BY turns.turn, outbox_messages.priority, outbox_messages.id
+LIMIT @batch_size
+FOR UPDATE OF outbox_messages SKIP LOCKED;
+
+-- name: MarkOutboxMessageSent :exec
+UPDATE outbox_messages
+SET
+    sent_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
+
+-- name: MarkOutboxMessageFailed :exec
+UPDATE outbox_messages
+SET
+    attempts = attempts + 1,
+    last_error = $2,
+    next_attempt_at = $3
+WHERE
+    id = $1;
@@ -3,9 +3,10 @@ INSERT INTO
     tasks (
         file_id,
         job_id,
-        target_format
+        target_format,
+        options
     )
-VALUES ($1, $2, $3)
+VALUES ($1, $2, $3, $4)
 RETURNING
     *;
 
@@ -17,6 +18,15 @@ FROM tasks t
     LEFT JOIN files f ON f.id = t.file_id
 WHERE t.id = $1;
 
+-- name: GetTaskByIDAndOwner :one
+SELECT 
+    t.*,
+    sqlc.embed(f) 
+FROM tasks t
+    JOIN jobs j ON j.id = t.job_id
+    LEFT JOIN files f ON f.id = t.file_id
+WHERE t.id = $1 AND j.owner_id = $2;
+
 -- name: GetTasksByJobID :many
 SELECT 
     t.*,
@@ -25,6 +35,22 @@ FROM tasks t
     LEFT JOIN files f ON f.id = t.file_id
 WHERE t.job_id = $1;
 
+-- name: ClaimTask :one
+UPDATE tasks
+SET
+    status = 'processing',
+    started_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = @id
+    AND (
+        status = 'pending'
+        -- Taken over from a worker that stopped renewing its lease
+        OR (status = 'processing' AND updated_at < CURRENT_TIMESTAMP - make_interval(secs => @lease_seconds::float8))
+    )
+RETURNING
+    *;
+
 -- name: UpdateTaskStatus :one
 UPDATE tasks
 SET
@@ -35,5 +61,108 @@ SET
     error_message = COALESCE($6, error_message)
 WHERE
     id = $1
+    AND status = 'processing'
+    AND attempts = $7
+RETURNING
+    *;
+
+-- name: CancelTask :one
+UPDATE tasks
+SET
+    status = 'cancelled',
+    completed_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND status IN ('pending', 'processing')
+RETURNING
+    *;
+
+-- name: CancelJobTasks :many
+UPDATE tasks
+SET
+    status = 'cancelled',
+    completed_at = CURRENT_TIMESTAMP
+WHERE
+    job_id = $1
+    AND status IN ('pending', 'processing')
+RETURNING
+    *;
+
+-- name: CreateTaskInput :exec
+INSERT INTO
+    task_inputs (task_id, file_id, position)
+VALUES ($1, $2, $3);
+
+-- name: GetTaskInputs :many
+SELECT sqlc.embed(f)
+FROM task_inputs ti
+    JOIN files f ON f.id = ti.file_id
+WHERE ti.task_id = $1
+ORDER BY ti.position;
+
+-- name: IncrementTaskAttempts :one
+UPDATE tasks
+SET
+    attempts = attempts + 1
+WHERE
+    id = $1
+RETURNING
+    attempts;
+
+-- name: RenewTaskLease :execrows
+UPDATE tasks
+SET
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND status = 'processing'
+    AND attempts = $2;
+
+-- name: RequeueTask :one
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL
+WHERE
+    id = $1
+    AND status = 'processing'
+    AND attempts = $2
 RETURNING
-    *;
\ No newline at end of file
+    *;
+
+-- name: RetryTask :one
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL,
+    completed_at = NULL,
+    converted_file_name = NULL,
+    error_message = NULL
+WHERE
+    id = $1
+    AND status = 'failed'
+RETURNING
+    *;
+
+-- name: RetryJobFailedTasks :many
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL,
+    completed_at = NULL,
+    converted_file_name = NULL,
+    error_message = NULL
+WHERE
+    job_id = $1
+    AND status = 'failed'
+RETURNING
+    *;
+
+-- name: CountPendingTasksByPriority :many
+SELECT
+    jobs.priority,
+    COUNT(*)::int AS pending_tasks
+FROM tasks
+    JOIN jobs ON jobs.id = tasks.job_id
+WHERE tasks.status = 'pending'
+GROUP BY jobs.priority;
@@ -0,0 +1,28 @@
+-- name: CreateTaskAttempt :exec
+INSERT INTO
+    task_attempts (
+        task_id,
+        attempt,
+        worker_id,
+        status,
+        started_at
+    )
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: FinishTaskAttempt :exec
+UPDATE task_attempts
+SET
+    status = $3,
+    error_message = $4,
+    completed_at = $5
+WHERE
+    task_id = $1
+    AND attempt = $2
+    AND completed_at IS NULL;
+
+-- name: GetTaskAttempts :many
+SELECT *
+FROM task_attempts
+WHERE
+    task_id = $1
+ORDER BY attempt;
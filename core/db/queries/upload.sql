@@ -0,0 +1,13 @@
+-- name: CreateUpload :one
+INSERT INTO
+    uploads (object_name, owner_id, original_name)
+VALUES ($1, $2, $3)
+RETURNING
+    *;
+
+-- name: GetUpload :one
+SELECT *
+FROM uploads
+WHERE
+    object_name = $1
+    AND owner_id = $2;
@@ -0,0 +1,80 @@
+-- name: CreateWebhookDelivery :exec
+INSERT INTO
+    webhook_deliveries (job_id, task_id, event, payload, generation)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (job_id, event, generation) WHERE task_id IS NULL DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+WITH claimed AS (
+    UPDATE webhook_deliveries
+    SET
+        next_attempt_at = sqlc.arg(lease_until)
+    WHERE
+        id IN (
+            SELECT id
+            FROM webhook_deliveries
+            WHERE
+                status = 'pending'
+                AND next_attempt_at <= CURRENT_TIMESTAMP
+            ORDER BY next_attempt_at
+            LIMIT sqlc.arg(batch_size)
+            FOR UPDATE SKIP LOCKED
+        )
+    RETURNING
+        *
+)
+SELECT c.id, c.event, c.payload, c.attempts, j.callback_url, s.secret AS callback_secret
+FROM claimed c
+    JOIN jobs j ON j.id = c.job_id
+    LEFT JOIN webhook_secrets s ON s.owner_id = j.owner_id;
+
+-- name: UpdateWebhookDelivery :exec
+UPDATE webhook_deliveries
+SET
+    status = $2,
+    attempts = $3,
+    next_attempt_at = $4,
+    last_error = $5,
+    delivered_at = $6,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1;
+
+-- name: CreateWebhookAttempt :exec
+INSERT INTO
+    webhook_attempts (delivery_id, attempt, status_code, error, duration_ms)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetWebhookDeliveriesByJobID :many
+SELECT *
+FROM webhook_deliveries
+WHERE job_id = $1
+ORDER BY id;
+
+-- name: GetWebhookAttemptsByJobID :many
+SELECT a.*
+FROM webhook_attempts a
+    JOIN webhook_deliveries d ON d.id = a.delivery_id
+WHERE d.job_id = $1
+ORDER BY a.delivery_id, a.attempt;
+
+-- name: GetOrCreateWebhookSecret :one
+INSERT INTO
+    webhook_secrets (owner_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (owner_id) DO UPDATE
+SET
+    owner_id = EXCLUDED.owner_id
+RETURNING
+    *;
+
+-- name: RotateWebhookSecret :one
+INSERT INTO
+    webhook_secrets (owner_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (owner_id) DO UPDATE
+SET
+    secret = EXCLUDED.secret,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING
+    *;
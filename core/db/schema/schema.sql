@@ -1,9 +1,18 @@
-CREATE TYPE task_status AS ENUM ('pending', 'processing', 'completed', 'failed');
+CREATE TYPE task_status AS ENUM ('pending', 'processing', 'completed', 'failed', 'cancelled');
+
+CREATE TYPE webhook_status AS ENUM ('pending', 'delivered', 'failed');
+
+CREATE TYPE job_priority AS ENUM ('interactive', 'normal', 'bulk');
 
 CREATE TABLE jobs (
     id SERIAL PRIMARY KEY,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    callback_url TEXT,
+    owner_id VARCHAR(255) NOT NULL DEFAULT '',
+    priority job_priority NOT NULL DEFAULT 'normal',
+    -- Bumped whenever failed tasks are retried, so the job can finish again
+    generation INT NOT NULL DEFAULT 0
 );
 
 CREATE TABLE files (
@@ -12,7 +21,20 @@ CREATE TABLE files (
     original_name VARCHAR(255) NOT NULL,
     original_format VARCHAR(50) NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    owner_id VARCHAR(255) NOT NULL DEFAULT ''
+);
+
+-- Serves listing an owner's jobs by creation time
+CREATE INDEX "idx_jobs_owner_id_created_at" ON "jobs" ("owner_id", "created_at", "id");
+CREATE INDEX "idx_files_owner_id" ON "files" ("owner_id");
+
+-- Object names handed out for uploads, so jobs only convert their owner's files
+CREATE TABLE uploads (
+    object_name UUID PRIMARY KEY,
+    owner_id VARCHAR(255) NOT NULL,
+    original_name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE tasks (
@@ -21,16 +43,161 @@ CREATE TABLE tasks (
     job_id INT REFERENCES jobs (id) ON DELETE CASCADE,
     converted_file_name VARCHAR(255),
     target_format VARCHAR(50) NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
     status task_status DEFAULT 'pending',
     started_at TIMESTAMP WITH TIME ZONE,
     completed_at TIMESTAMP WITH TIME ZONE,
     error_message TEXT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE task_inputs (
+    task_id INT NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    file_id INT NOT NULL REFERENCES files (id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    PRIMARY KEY (task_id, position)
 );
 
 CREATE INDEX "idx_tasks_file_id" ON "tasks" ("file_id");
 -- Create index "idx_tasks_job_id" to table: "tasks"
 CREATE INDEX "idx_tasks_job_id" ON "tasks" ("job_id");
 -- Create index "idx_tasks_status" to table: "tasks"
-CREATE INDEX "idx_tasks_status" ON "tasks" ("status");
\ No newline at end of file
+CREATE INDEX "idx_tasks_status" ON "tasks" ("status");
+
+-- Every job with the task counts and status derived from its tasks
+CREATE VIEW job_summaries AS
+SELECT
+    jobs.id,
+    jobs.created_at,
+    jobs.updated_at,
+    jobs.callback_url,
+    jobs.owner_id,
+    jobs.priority,
+    jobs.generation,
+    counts.total_tasks,
+    counts.pending_tasks,
+    counts.processing_tasks,
+    counts.completed_tasks,
+    counts.failed_tasks,
+    counts.cancelled_tasks,
+    counts.started_at,
+    summary.status,
+    summary.finished_at
+FROM jobs
+    CROSS JOIN LATERAL (
+        SELECT
+            COUNT(*)::int AS total_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'pending')::int AS pending_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'processing')::int AS processing_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'completed')::int AS completed_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'failed')::int AS failed_tasks,
+            COUNT(*) FILTER (WHERE tasks.status = 'cancelled')::int AS cancelled_tasks,
+            MIN(tasks.started_at)::timestamptz AS started_at,
+            MAX(tasks.completed_at)::timestamptz AS last_completed_at
+        FROM tasks
+        WHERE tasks.job_id = jobs.id
+    ) counts
+    CROSS JOIN LATERAL (
+        -- Cancelled tasks do not count against the outcome of the others
+        SELECT CASE
+            WHEN counts.total_tasks = 0 THEN 'pending'
+            WHEN counts.pending_tasks > 0 AND counts.processing_tasks + counts.completed_tasks + counts.failed_tasks = 0 THEN 'pending'
+            WHEN counts.pending_tasks + counts.processing_tasks > 0 THEN 'running'
+            WHEN counts.cancelled_tasks = counts.total_tasks THEN 'cancelled'
+            WHEN counts.failed_tasks = 0 THEN 'completed'
+            WHEN counts.completed_tasks = 0 THEN 'failed'
+            ELSE 'partially_failed'
+        END::text AS status,
+        CASE
+            WHEN counts.total_tasks > 0 AND counts.pending_tasks + counts.processing_tasks = 0 THEN counts.last_completed_at
+        END::timestamptz AS finished_at
+    ) summary;
+
+CREATE TABLE task_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    task_id INT NOT NULL REFERENCES tasks (id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    worker_id VARCHAR(255) NOT NULL,
+    status task_status NOT NULL,
+    error_message TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (task_id, attempt)
+);
+
+CREATE TABLE outbox_messages (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    task_id INT REFERENCES tasks (id) ON DELETE CASCADE,
+    priority job_priority NOT NULL DEFAULT 'normal',
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX "idx_outbox_messages_unsent" ON "outbox_messages" ("id") WHERE sent_at IS NULL;
+-- Serves telling dispatched tasks from those still waiting in the outbox
+CREATE INDEX "idx_outbox_messages_unsent_task_id" ON "outbox_messages" ("task_id") WHERE sent_at IS NULL;
+
+CREATE TABLE webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    job_id INT NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+    task_id INT REFERENCES tasks (id) ON DELETE CASCADE,
+    event VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    status webhook_status NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    generation INT NOT NULL DEFAULT 0
+);
+
+CREATE INDEX "idx_webhook_deliveries_job_id" ON "webhook_deliveries" ("job_id");
+CREATE INDEX "idx_webhook_deliveries_due" ON "webhook_deliveries" ("next_attempt_at") WHERE status = 'pending';
+-- A job announces its final state once per generation
+CREATE UNIQUE INDEX "idx_webhook_deliveries_job_event" ON "webhook_deliveries" ("job_id", "event", "generation") WHERE task_id IS NULL;
+
+CREATE TABLE webhook_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    delivery_id BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    duration_ms INT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX "idx_webhook_attempts_delivery_id" ON "webhook_attempts" ("delivery_id");
+
+-- Every job of an owner is signed with the owner's secret
+CREATE TABLE webhook_secrets (
+    owner_id VARCHAR(255) PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE api_keys (
+    id SERIAL PRIMARY KEY,
+    owner_id VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    prefix VARCHAR(32) NOT NULL UNIQUE,
+    key_hash VARCHAR(255) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX "idx_api_keys_owner_id" ON "api_keys" ("owner_id");
@@ -16,21 +16,28 @@ INSERT INTO
     files (
         object_name,
         original_name,
-        original_format
+        original_format,
+        owner_id
     )
-VALUES ($1, $2, $3)
+VALUES ($1, $2, $3, $4)
 RETURNING
-    id, object_name, original_name, original_format, created_at, updated_at
+    id, object_name, original_name, original_format, created_at, updated_at, owner_id
 `
 
 type CreateFileParams struct {
 	ObjectName     pgtype.UUID
 	OriginalName   string
 	OriginalFormat string
+	OwnerID        string
 }
 
 func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, error) {
-	row := q.db.QueryRow(ctx, createFile, arg.ObjectName, arg.OriginalName, arg.OriginalFormat)
+	row := q.db.QueryRow(ctx, createFile,
+		arg.ObjectName,
+		arg.OriginalName,
+		arg.OriginalFormat,
+		arg.OwnerID,
+	)
 	var i File
 	err := row.Scan(
 		&i.ID,
@@ -39,16 +46,22 @@ func (q *Queries) CreateFile(ctx context.Context, arg CreateFileParams) (File, e
 		&i.OriginalFormat,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.OwnerID,
 	)
 	return i, err
 }
 
 const getFileByID = `-- name: GetFileByID :one
-SELECT id, object_name, original_name, original_format, created_at, updated_at FROM files WHERE id = $1
+SELECT id, object_name, original_name, original_format, created_at, updated_at, owner_id FROM files WHERE id = $1 AND owner_id = $2
 `
 
-func (q *Queries) GetFileByID(ctx context.Context, id int32) (File, error) {
-	row := q.db.QueryRow(ctx, getFileByID, id)
+type GetFileByIDParams struct {
+	ID      int32
+	OwnerID string
+}
+
+func (q *Queries) GetFileByID(ctx context.Context, arg GetFileByIDParams) (File, error) {
+	row := q.db.QueryRow(ctx, getFileByID, arg.ID, arg.OwnerID)
 	var i File
 	err := row.Scan(
 		&i.ID,
@@ -57,6 +70,7 @@ func (q *Queries) GetFileByID(ctx context.Context, id int32) (File, error) {
 		&i.OriginalFormat,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.OwnerID,
 	)
 	return i, err
 }
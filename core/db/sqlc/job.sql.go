@@ -7,30 +7,305 @@ package sql
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const bumpJobGeneration = `-- name: BumpJobGeneration :exec
+UPDATE jobs
+SET
+    generation = generation + 1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+`
+
+func (q *Queries) BumpJobGeneration(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, bumpJobGeneration, id)
+	return err
+}
+
 const createJob = `-- name: CreateJob :one
-INSERT INTO jobs DEFAULT
-VALUES
-RETURNING id, created_at, updated_at
+INSERT INTO
+    jobs (owner_id, callback_url, priority)
+VALUES ($1, $2, $3)
+RETURNING
+    id, created_at, updated_at, callback_url, owner_id, priority, generation
 `
 
-func (q *Queries) CreateJob(ctx context.Context) (Job, error) {
-	row := q.db.QueryRow(ctx, createJob)
+type CreateJobParams struct {
+	OwnerID     string
+	CallbackUrl pgtype.Text
+	Priority    JobPriority
+}
+
+func (q *Queries) CreateJob(ctx context.Context, arg CreateJobParams) (Job, error) {
+	row := q.db.QueryRow(ctx, createJob, arg.OwnerID, arg.CallbackUrl, arg.Priority)
 	var i Job
-	err := row.Scan(&i.ID, &i.CreatedAt, &i.UpdatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CallbackUrl,
+		&i.OwnerID,
+		&i.Priority,
+		&i.Generation,
+	)
 	return i, err
 }
 
 const getJobByID = `-- name: GetJobByID :one
-SELECT id, created_at, updated_at
+SELECT id, created_at, updated_at, callback_url, owner_id, priority, generation, total_tasks, pending_tasks, processing_tasks, completed_tasks, failed_tasks, cancelled_tasks, started_at, status, finished_at
+FROM job_summaries
+WHERE id = $1 AND owner_id = $2
+`
+
+type GetJobByIDParams struct {
+	ID      int32
+	OwnerID string
+}
+
+func (q *Queries) GetJobByID(ctx context.Context, arg GetJobByIDParams) (JobSummary, error) {
+	row := q.db.QueryRow(ctx, getJobByID, arg.ID, arg.OwnerID)
+	var i JobSummary
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CallbackUrl,
+		&i.OwnerID,
+		&i.Priority,
+		&i.Generation,
+		&i.TotalTasks,
+		&i.PendingTasks,
+		&i.ProcessingTasks,
+		&i.CompletedTasks,
+		&i.FailedTasks,
+		&i.CancelledTasks,
+		&i.StartedAt,
+		&i.Status,
+		&i.FinishedAt,
+	)
+	return i, err
+}
+
+const getJobByIDForUpdate = `-- name: GetJobByIDForUpdate :one
+SELECT id, created_at, updated_at, callback_url, owner_id, priority, generation
 FROM jobs
 WHERE id = $1
+FOR UPDATE
 `
 
-func (q *Queries) GetJobByID(ctx context.Context, id int32) (Job, error) {
-	row := q.db.QueryRow(ctx, getJobByID, id)
+func (q *Queries) GetJobByIDForUpdate(ctx context.Context, id int32) (Job, error) {
+	row := q.db.QueryRow(ctx, getJobByIDForUpdate, id)
 	var i Job
-	err := row.Scan(&i.ID, &i.CreatedAt, &i.UpdatedAt)
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.CallbackUrl,
+		&i.OwnerID,
+		&i.Priority,
+		&i.Generation,
+	)
 	return i, err
 }
+
+const getJobPriority = `-- name: GetJobPriority :one
+SELECT priority
+FROM jobs
+WHERE id = $1
+`
+
+func (q *Queries) GetJobPriority(ctx context.Context, id int32) (JobPriority, error) {
+	row := q.db.QueryRow(ctx, getJobPriority, id)
+	var priority JobPriority
+	err := row.Scan(&priority)
+	return priority, err
+}
+
+const listJobsNewestFirst = `-- name: ListJobsNewestFirst :many
+SELECT job_summaries.id, job_summaries.created_at, job_summaries.updated_at, job_summaries.callback_url, job_summaries.owner_id, job_summaries.priority, job_summaries.generation, job_summaries.total_tasks, job_summaries.pending_tasks, job_summaries.processing_tasks, job_summaries.completed_tasks, job_summaries.failed_tasks, job_summaries.cancelled_tasks, job_summaries.started_at, job_summaries.status, job_summaries.finished_at
+FROM (
+    -- The page is cut on jobs and their owner index, so only its jobs are
+    -- summarized. Status is derived from the summary: with a status filter,
+    -- jobs are summarized in page order until the page is full, which walks
+    -- all of the owner's jobs if few have that status.
+    SELECT id, created_at
+    FROM jobs
+    WHERE
+        owner_id = $1
+        AND ($2::timestamptz IS NULL OR created_at >= $2)
+        AND ($3::timestamptz IS NULL OR created_at < $3)
+        AND (
+            $4::text IS NULL
+            OR EXISTS (
+                SELECT 1
+                FROM tasks
+                    JOIN files ON files.id = tasks.file_id
+                WHERE tasks.job_id = jobs.id
+                    AND files.original_name ILIKE '%' || $4 || '%'
+            )
+        )
+        AND (
+            $5::int IS NULL
+            OR (created_at, id) < ($6::timestamptz, $5)
+        )
+    ORDER BY created_at DESC, id DESC
+    LIMIT CASE WHEN $7::text IS NULL THEN $8::int END
+) page
+    JOIN job_summaries ON job_summaries.id = page.id
+WHERE $7::text IS NULL OR job_summaries.status = $7
+ORDER BY page.created_at DESC, page.id DESC
+LIMIT $8
+`
+
+type ListJobsNewestFirstParams struct {
+	OwnerID         string
+	CreatedAfter    pgtype.Timestamptz
+	CreatedBefore   pgtype.Timestamptz
+	FileName        pgtype.Text
+	CursorID        pgtype.Int4
+	CursorCreatedAt pgtype.Timestamptz
+	Status          pgtype.Text
+	PageSize        int32
+}
+
+func (q *Queries) ListJobsNewestFirst(ctx context.Context, arg ListJobsNewestFirstParams) ([]JobSummary, error) {
+	rows, err := q.db.Query(ctx, listJobsNewestFirst,
+		arg.OwnerID,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.FileName,
+		arg.CursorID,
+		arg.CursorCreatedAt,
+		arg.Status,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JobSummary
+	for rows.Next() {
+		var i JobSummary
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CallbackUrl,
+			&i.OwnerID,
+			&i.Priority,
+			&i.Generation,
+			&i.TotalTasks,
+			&i.PendingTasks,
+			&i.ProcessingTasks,
+			&i.CompletedTasks,
+			&i.FailedTasks,
+			&i.CancelledTasks,
+			&i.StartedAt,
+			&i.Status,
+			&i.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listJobsOldestFirst = `-- name: ListJobsOldestFirst :many
+SELECT job_summaries.id, job_summaries.created_at, job_summaries.updated_at, job_summaries.callback_url, job_summaries.owner_id, job_summaries.priority, job_summaries.generation, job_summaries.total_tasks, job_summaries.pending_tasks, job_summaries.processing_tasks, job_summaries.completed_tasks, job_summaries.failed_tasks, job_summaries.cancelled_tasks, job_summaries.started_at, job_summaries.status, job_summaries.finished_at
+FROM (
+    -- The page is cut on jobs and their owner index, so only its jobs are
+    -- summarized. Status is derived from the summary: with a status filter,
+    -- jobs are summarized in page order until the page is full, which walks
+    -- all of the owner's jobs if few have that status.
+    SELECT id, created_at
+    FROM jobs
+    WHERE
+        owner_id = $1
+        AND ($2::timestamptz IS NULL OR created_at >= $2)
+        AND ($3::timestamptz IS NULL OR created_at < $3)
+        AND (
+            $4::text IS NULL
+            OR EXISTS (
+                SELECT 1
+                FROM tasks
+                    JOIN files ON files.id = tasks.file_id
+                WHERE tasks.job_id = jobs.id
+                    AND files.original_name ILIKE '%' || $4 || '%'
+            )
+        )
+        AND (
+            $5::int IS NULL
+            OR (created_at, id) > ($6::timestamptz, $5)
+        )
+    ORDER BY created_at ASC, id ASC
+    LIMIT CASE WHEN $7::text IS NULL THEN $8::int END
+) page
+    JOIN job_summaries ON job_summaries.id = page.id
+WHERE $7::text IS NULL OR job_summaries.status = $7
+ORDER BY page.created_at ASC, page.id ASC
+LIMIT $8
+`
+
+type ListJobsOldestFirstParams struct {
+	OwnerID         string
+	CreatedAfter    pgtype.Timestamptz
+	CreatedBefore   pgtype.Timestamptz
+	FileName        pgtype.Text
+	CursorID        pgtype.Int4
+	CursorCreatedAt pgtype.Timestamptz
+	Status          pgtype.Text
+	PageSize        int32
+}
+
+func (q *Queries) ListJobsOldestFirst(ctx context.Context, arg ListJobsOldestFirstParams) ([]JobSummary, error) {
+	rows, err := q.db.Query(ctx, listJobsOldestFirst,
+		arg.OwnerID,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.FileName,
+		arg.CursorID,
+		arg.CursorCreatedAt,
+		arg.Status,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []JobSummary
+	for rows.Next() {
+		var i JobSummary
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.CallbackUrl,
+			&i.OwnerID,
+			&i.Priority,
+			&i.Generation,
+			&i.TotalTasks,
+			&i.PendingTasks,
+			&i.ProcessingTasks,
+			&i.CompletedTasks,
+			&i.FailedTasks,
+			&i.CancelledTasks,
+			&i.StartedAt,
+			&i.Status,
+			&i.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -11,6 +11,49 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type JobPriority string
+
+const (
+	JobPriorityInteractive JobPriority = "interactive"
+	JobPriorityNormal      JobPriority = "normal"
+	JobPriorityBulk        JobPriority = "bulk"
+)
+
+func (e *JobPriority) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = JobPriority(s)
+	case string:
+		*e = JobPriority(s)
+	default:
+		return fmt.Errorf("unsupported scan type for JobPriority: %T", src)
+	}
+	return nil
+}
+
+type NullJobPriority struct {
+	JobPriority JobPriority
+	Valid       bool // Valid is true if JobPriority is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullJobPriority) Scan(value interface{}) error {
+	if value == nil {
+		ns.JobPriority, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.JobPriority.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullJobPriority) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.JobPriority), nil
+}
+
 type TaskStatus string
 
 const (
@@ -18,6 +61,7 @@ const (
 	TaskStatusProcessing TaskStatus = "processing"
 	TaskStatusCompleted  TaskStatus = "completed"
 	TaskStatusFailed     TaskStatus = "failed"
+	TaskStatusCancelled  TaskStatus = "cancelled"
 )
 
 func (e *TaskStatus) Scan(src interface{}) error {
@@ -55,6 +99,63 @@ func (ns NullTaskStatus) Value() (driver.Value, error) {
 	return string(ns.TaskStatus), nil
 }
 
+type WebhookStatus string
+
+const (
+	WebhookStatusPending   WebhookStatus = "pending"
+	WebhookStatusDelivered WebhookStatus = "delivered"
+	WebhookStatusFailed    WebhookStatus = "failed"
+)
+
+func (e *WebhookStatus) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = WebhookStatus(s)
+	case string:
+		*e = WebhookStatus(s)
+	default:
+		return fmt.Errorf("unsupported scan type for WebhookStatus: %T", src)
+	}
+	return nil
+}
+
+type NullWebhookStatus struct {
+	WebhookStatus WebhookStatus
+	Valid         bool // Valid is true if WebhookStatus is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullWebhookStatus) Scan(value interface{}) error {
+	if value == nil {
+		ns.WebhookStatus, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.WebhookStatus.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullWebhookStatus) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.WebhookStatus), nil
+}
+
+type ApiKey struct {
+	ID         int32
+	OwnerID    string
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	ExpiresAt  pgtype.Timestamptz
+	LastUsedAt pgtype.Timestamptz
+	RevokedAt  pgtype.Timestamptz
+	CreatedAt  pgtype.Timestamptz
+	UpdatedAt  pgtype.Timestamptz
+}
+
 type File struct {
 	ID             int32
 	ObjectName     pgtype.UUID
@@ -62,12 +163,49 @@ type File struct {
 	OriginalFormat string
 	CreatedAt      pgtype.Timestamptz
 	UpdatedAt      pgtype.Timestamptz
+	OwnerID        string
 }
 
 type Job struct {
-	ID        int32
-	CreatedAt pgtype.Timestamptz
-	UpdatedAt pgtype.Timestamptz
+	ID          int32
+	CreatedAt   pgtype.Timestamptz
+	UpdatedAt   pgtype.Timestamptz
+	CallbackUrl pgtype.Text
+	OwnerID     string
+	Priority    JobPriority
+	Generation  int32
+}
+
+type JobSummary struct {
+	ID              int32
+	CreatedAt       pgtype.Timestamptz
+	UpdatedAt       pgtype.Timestamptz
+	CallbackUrl     pgtype.Text
+	OwnerID         string
+	Priority        JobPriority
+	Generation      int32
+	TotalTasks      int32
+	PendingTasks    int32
+	ProcessingTasks int32
+	CompletedTasks  int32
+	FailedTasks     int32
+	CancelledTasks  int32
+	StartedAt       pgtype.Timestamptz
+	Status          string
+	FinishedAt      pgtype.Timestamptz
+}
+
+type OutboxMessage struct {
+	ID            int64
+	Queue         string
+	Payload       []byte
+	Attempts      int32
+	LastError     pgtype.Text
+	CreatedAt     pgtype.Timestamptz
+	SentAt        pgtype.Timestamptz
+	TaskID        pgtype.Int4
+	Priority      JobPriority
+	NextAttemptAt pgtype.Timestamptz
 }
 
 type Task struct {
@@ -76,10 +214,70 @@ type Task struct {
 	JobID             pgtype.Int4
 	ConvertedFileName pgtype.Text
 	TargetFormat      string
+	Options           []byte
 	Status            NullTaskStatus
 	StartedAt         pgtype.Timestamptz
 	CompletedAt       pgtype.Timestamptz
 	ErrorMessage      pgtype.Text
 	CreatedAt         pgtype.Timestamptz
 	UpdatedAt         pgtype.Timestamptz
+	Attempts          int32
+}
+
+type TaskAttempt struct {
+	ID           int64
+	TaskID       int32
+	Attempt      int32
+	WorkerID     string
+	Status       TaskStatus
+	ErrorMessage pgtype.Text
+	StartedAt    pgtype.Timestamptz
+	CompletedAt  pgtype.Timestamptz
+	CreatedAt    pgtype.Timestamptz
+}
+
+type TaskInput struct {
+	TaskID   int32
+	FileID   int32
+	Position int32
+}
+
+type Upload struct {
+	ObjectName   pgtype.UUID
+	OwnerID      string
+	OriginalName string
+	CreatedAt    pgtype.Timestamptz
+}
+
+type WebhookAttempt struct {
+	ID         int64
+	DeliveryID int64
+	Attempt    int32
+	StatusCode pgtype.Int4
+	Error      pgtype.Text
+	DurationMs int32
+	CreatedAt  pgtype.Timestamptz
+}
+
+type WebhookDelivery struct {
+	ID            int64
+	JobID         int32
+	TaskID        pgtype.Int4
+	Event         string
+	Payload       []byte
+	Status        WebhookStatus
+	Attempts      int32
+	NextAttemptAt pgtype.Timestamptz
+	LastError     pgtype.Text
+	DeliveredAt   pgtype.Timestamptz
+	CreatedAt     pgtype.Timestamptz
+	UpdatedAt     pgtype.Timestamptz
+	Generation    int32
+}
+
+type WebhookSecret struct {
+	OwnerID   string
+	Secret    string
+	CreatedAt pgtype.Timestamptz
+	UpdatedAt pgtype.Timestamptz
 }
@@ -11,26 +11,190 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cancelJobTasks = `-- name: CancelJobTasks :many
+UPDATE tasks
+SET
+    status = 'cancelled',
+    completed_at = CURRENT_TIMESTAMP
+WHERE
+    job_id = $1
+    AND status IN ('pending', 'processing')
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+func (q *Queries) CancelJobTasks(ctx context.Context, jobID pgtype.Int4) ([]Task, error) {
+	rows, err := q.db.Query(ctx, cancelJobTasks, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileID,
+			&i.JobID,
+			&i.ConvertedFileName,
+			&i.TargetFormat,
+			&i.Options,
+			&i.Status,
+			&i.StartedAt,
+			&i.CompletedAt,
+			&i.ErrorMessage,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Attempts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const cancelTask = `-- name: CancelTask :one
+UPDATE tasks
+SET
+    status = 'cancelled',
+    completed_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND status IN ('pending', 'processing')
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+func (q *Queries) CancelTask(ctx context.Context, id int32) (Task, error) {
+	row := q.db.QueryRow(ctx, cancelTask, id)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.JobID,
+		&i.ConvertedFileName,
+		&i.TargetFormat,
+		&i.Options,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ErrorMessage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const claimTask = `-- name: ClaimTask :one
+UPDATE tasks
+SET
+    status = 'processing',
+    started_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND (
+        status = 'pending'
+        -- Taken over from a worker that stopped renewing its lease
+        OR (status = 'processing' AND updated_at < CURRENT_TIMESTAMP - make_interval(secs => $2::float8))
+    )
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+type ClaimTaskParams struct {
+	ID           int32
+	LeaseSeconds float64
+}
+
+func (q *Queries) ClaimTask(ctx context.Context, arg ClaimTaskParams) (Task, error) {
+	row := q.db.QueryRow(ctx, claimTask, arg.ID, arg.LeaseSeconds)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.JobID,
+		&i.ConvertedFileName,
+		&i.TargetFormat,
+		&i.Options,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ErrorMessage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const countPendingTasksByPriority = `-- name: CountPendingTasksByPriority :many
+SELECT
+    jobs.priority,
+    COUNT(*)::int AS pending_tasks
+FROM tasks
+    JOIN jobs ON jobs.id = tasks.job_id
+WHERE tasks.status = 'pending'
+GROUP BY jobs.priority
+`
+
+type CountPendingTasksByPriorityRow struct {
+	Priority     JobPriority
+	PendingTasks int32
+}
+
+func (q *Queries) CountPendingTasksByPriority(ctx context.Context) ([]CountPendingTasksByPriorityRow, error) {
+	rows, err := q.db.Query(ctx, countPendingTasksByPriority)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountPendingTasksByPriorityRow
+	for rows.Next() {
+		var i CountPendingTasksByPriorityRow
+		if err := rows.Scan(&i.Priority, &i.PendingTasks); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const createTask = `-- name: CreateTask :one
 INSERT INTO
     tasks (
         file_id,
         job_id,
-        target_format
+        target_format,
+        options
     )
-VALUES ($1, $2, $3)
+VALUES ($1, $2, $3, $4)
 RETURNING
-    id, file_id, job_id, converted_file_name, target_format, status, started_at, completed_at, error_message, created_at, updated_at
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
 `
 
 type CreateTaskParams struct {
 	FileID       pgtype.Int4
 	JobID        pgtype.Int4
 	TargetFormat string
+	Options      []byte
 }
 
 func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, error) {
-	row := q.db.QueryRow(ctx, createTask, arg.FileID, arg.JobID, arg.TargetFormat)
+	row := q.db.QueryRow(ctx, createTask,
+		arg.FileID,
+		arg.JobID,
+		arg.TargetFormat,
+		arg.Options,
+	)
 	var i Task
 	err := row.Scan(
 		&i.ID,
@@ -38,20 +202,39 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		&i.JobID,
 		&i.ConvertedFileName,
 		&i.TargetFormat,
+		&i.Options,
 		&i.Status,
 		&i.StartedAt,
 		&i.CompletedAt,
 		&i.ErrorMessage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Attempts,
 	)
 	return i, err
 }
 
+const createTaskInput = `-- name: CreateTaskInput :exec
+INSERT INTO
+    task_inputs (task_id, file_id, position)
+VALUES ($1, $2, $3)
+`
+
+type CreateTaskInputParams struct {
+	TaskID   int32
+	FileID   int32
+	Position int32
+}
+
+func (q *Queries) CreateTaskInput(ctx context.Context, arg CreateTaskInputParams) error {
+	_, err := q.db.Exec(ctx, createTaskInput, arg.TaskID, arg.FileID, arg.Position)
+	return err
+}
+
 const getTaskByID = `-- name: GetTaskByID :one
 SELECT 
-    t.id, t.file_id, t.job_id, t.converted_file_name, t.target_format, t.status, t.started_at, t.completed_at, t.error_message, t.created_at, t.updated_at,
-    f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at 
+    t.id, t.file_id, t.job_id, t.converted_file_name, t.target_format, t.options, t.status, t.started_at, t.completed_at, t.error_message, t.created_at, t.updated_at, t.attempts,
+    f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at, f.owner_id 
 FROM tasks t
     LEFT JOIN files f ON f.id = t.file_id
 WHERE t.id = $1
@@ -63,12 +246,14 @@ type GetTaskByIDRow struct {
 	JobID             pgtype.Int4
 	ConvertedFileName pgtype.Text
 	TargetFormat      string
+	Options           []byte
 	Status            NullTaskStatus
 	StartedAt         pgtype.Timestamptz
 	CompletedAt       pgtype.Timestamptz
 	ErrorMessage      pgtype.Text
 	CreatedAt         pgtype.Timestamptz
 	UpdatedAt         pgtype.Timestamptz
+	Attempts          int32
 	File              File
 }
 
@@ -81,26 +266,129 @@ func (q *Queries) GetTaskByID(ctx context.Context, id int32) (GetTaskByIDRow, er
 		&i.JobID,
 		&i.ConvertedFileName,
 		&i.TargetFormat,
+		&i.Options,
 		&i.Status,
 		&i.StartedAt,
 		&i.CompletedAt,
 		&i.ErrorMessage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Attempts,
 		&i.File.ID,
 		&i.File.ObjectName,
 		&i.File.OriginalName,
 		&i.File.OriginalFormat,
 		&i.File.CreatedAt,
 		&i.File.UpdatedAt,
+		&i.File.OwnerID,
 	)
 	return i, err
 }
 
+const getTaskByIDAndOwner = `-- name: GetTaskByIDAndOwner :one
+SELECT 
+    t.id, t.file_id, t.job_id, t.converted_file_name, t.target_format, t.options, t.status, t.started_at, t.completed_at, t.error_message, t.created_at, t.updated_at, t.attempts,
+    f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at, f.owner_id 
+FROM tasks t
+    JOIN jobs j ON j.id = t.job_id
+    LEFT JOIN files f ON f.id = t.file_id
+WHERE t.id = $1 AND j.owner_id = $2
+`
+
+type GetTaskByIDAndOwnerParams struct {
+	ID      int32
+	OwnerID string
+}
+
+type GetTaskByIDAndOwnerRow struct {
+	ID                int32
+	FileID            pgtype.Int4
+	JobID             pgtype.Int4
+	ConvertedFileName pgtype.Text
+	TargetFormat      string
+	Options           []byte
+	Status            NullTaskStatus
+	StartedAt         pgtype.Timestamptz
+	CompletedAt       pgtype.Timestamptz
+	ErrorMessage      pgtype.Text
+	CreatedAt         pgtype.Timestamptz
+	UpdatedAt         pgtype.Timestamptz
+	Attempts          int32
+	File              File
+}
+
+func (q *Queries) GetTaskByIDAndOwner(ctx context.Context, arg GetTaskByIDAndOwnerParams) (GetTaskByIDAndOwnerRow, error) {
+	row := q.db.QueryRow(ctx, getTaskByIDAndOwner, arg.ID, arg.OwnerID)
+	var i GetTaskByIDAndOwnerRow
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.JobID,
+		&i.ConvertedFileName,
+		&i.TargetFormat,
+		&i.Options,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ErrorMessage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Attempts,
+		&i.File.ID,
+		&i.File.ObjectName,
+		&i.File.OriginalName,
+		&i.File.OriginalFormat,
+		&i.File.CreatedAt,
+		&i.File.UpdatedAt,
+		&i.File.OwnerID,
+	)
+	return i, err
+}
+
+const getTaskInputs = `-- name: GetTaskInputs :many
+SELECT f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at, f.owner_id
+FROM task_inputs ti
+    JOIN files f ON f.id = ti.file_id
+WHERE ti.task_id = $1
+ORDER BY ti.position
+`
+
+type GetTaskInputsRow struct {
+	File File
+}
+
+func (q *Queries) GetTaskInputs(ctx context.Context, taskID int32) ([]GetTaskInputsRow, error) {
+	rows, err := q.db.Query(ctx, getTaskInputs, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetTaskInputsRow
+	for rows.Next() {
+		var i GetTaskInputsRow
+		if err := rows.Scan(
+			&i.File.ID,
+			&i.File.ObjectName,
+			&i.File.OriginalName,
+			&i.File.OriginalFormat,
+			&i.File.CreatedAt,
+			&i.File.UpdatedAt,
+			&i.File.OwnerID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getTasksByJobID = `-- name: GetTasksByJobID :many
 SELECT 
-    t.id, t.file_id, t.job_id, t.converted_file_name, t.target_format, t.status, t.started_at, t.completed_at, t.error_message, t.created_at, t.updated_at,
-    f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at
+    t.id, t.file_id, t.job_id, t.converted_file_name, t.target_format, t.options, t.status, t.started_at, t.completed_at, t.error_message, t.created_at, t.updated_at, t.attempts,
+    f.id, f.object_name, f.original_name, f.original_format, f.created_at, f.updated_at, f.owner_id
 FROM tasks t    
     LEFT JOIN files f ON f.id = t.file_id
 WHERE t.job_id = $1
@@ -112,12 +400,14 @@ type GetTasksByJobIDRow struct {
 	JobID             pgtype.Int4
 	ConvertedFileName pgtype.Text
 	TargetFormat      string
+	Options           []byte
 	Status            NullTaskStatus
 	StartedAt         pgtype.Timestamptz
 	CompletedAt       pgtype.Timestamptz
 	ErrorMessage      pgtype.Text
 	CreatedAt         pgtype.Timestamptz
 	UpdatedAt         pgtype.Timestamptz
+	Attempts          int32
 	File              File
 }
 
@@ -136,18 +426,149 @@ func (q *Queries) GetTasksByJobID(ctx context.Context, jobID pgtype.Int4) ([]Get
 			&i.JobID,
 			&i.ConvertedFileName,
 			&i.TargetFormat,
+			&i.Options,
 			&i.Status,
 			&i.StartedAt,
 			&i.CompletedAt,
 			&i.ErrorMessage,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Attempts,
 			&i.File.ID,
 			&i.File.ObjectName,
 			&i.File.OriginalName,
 			&i.File.OriginalFormat,
 			&i.File.CreatedAt,
 			&i.File.UpdatedAt,
+			&i.File.OwnerID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const incrementTaskAttempts = `-- name: IncrementTaskAttempts :one
+UPDATE tasks
+SET
+    attempts = attempts + 1
+WHERE
+    id = $1
+RETURNING
+    attempts
+`
+
+func (q *Queries) IncrementTaskAttempts(ctx context.Context, id int32) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementTaskAttempts, id)
+	var attempts int32
+	err := row.Scan(&attempts)
+	return attempts, err
+}
+
+const renewTaskLease = `-- name: RenewTaskLease :execrows
+UPDATE tasks
+SET
+    updated_at = CURRENT_TIMESTAMP
+WHERE
+    id = $1
+    AND status = 'processing'
+    AND attempts = $2
+`
+
+type RenewTaskLeaseParams struct {
+	ID       int32
+	Attempts int32
+}
+
+func (q *Queries) RenewTaskLease(ctx context.Context, arg RenewTaskLeaseParams) (int64, error) {
+	result, err := q.db.Exec(ctx, renewTaskLease, arg.ID, arg.Attempts)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const requeueTask = `-- name: RequeueTask :one
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL
+WHERE
+    id = $1
+    AND status = 'processing'
+    AND attempts = $2
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+type RequeueTaskParams struct {
+	ID       int32
+	Attempts int32
+}
+
+func (q *Queries) RequeueTask(ctx context.Context, arg RequeueTaskParams) (Task, error) {
+	row := q.db.QueryRow(ctx, requeueTask, arg.ID, arg.Attempts)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.JobID,
+		&i.ConvertedFileName,
+		&i.TargetFormat,
+		&i.Options,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ErrorMessage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Attempts,
+	)
+	return i, err
+}
+
+const retryJobFailedTasks = `-- name: RetryJobFailedTasks :many
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL,
+    completed_at = NULL,
+    converted_file_name = NULL,
+    error_message = NULL
+WHERE
+    job_id = $1
+    AND status = 'failed'
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+func (q *Queries) RetryJobFailedTasks(ctx context.Context, jobID pgtype.Int4) ([]Task, error) {
+	rows, err := q.db.Query(ctx, retryJobFailedTasks, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.FileID,
+			&i.JobID,
+			&i.ConvertedFileName,
+			&i.TargetFormat,
+			&i.Options,
+			&i.Status,
+			&i.StartedAt,
+			&i.CompletedAt,
+			&i.ErrorMessage,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Attempts,
 		); err != nil {
 			return nil, err
 		}
@@ -159,6 +580,42 @@ func (q *Queries) GetTasksByJobID(ctx context.Context, jobID pgtype.Int4) ([]Get
 	return items, nil
 }
 
+const retryTask = `-- name: RetryTask :one
+UPDATE tasks
+SET
+    status = 'pending',
+    started_at = NULL,
+    completed_at = NULL,
+    converted_file_name = NULL,
+    error_message = NULL
+WHERE
+    id = $1
+    AND status = 'failed'
+RETURNING
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
+`
+
+func (q *Queries) RetryTask(ctx context.Context, id int32) (Task, error) {
+	row := q.db.QueryRow(ctx, retryTask, id)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.FileID,
+		&i.JobID,
+		&i.ConvertedFileName,
+		&i.TargetFormat,
+		&i.Options,
+		&i.Status,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.ErrorMessage,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Attempts,
+	)
+	return i, err
+}
+
 const updateTaskStatus = `-- name: UpdateTaskStatus :one
 UPDATE tasks
 SET
@@ -169,8 +626,10 @@ SET
     error_message = COALESCE($6, error_message)
 WHERE
     id = $1
+    AND status = 'processing'
+    AND attempts = $7
 RETURNING
-    id, file_id, job_id, converted_file_name, target_format, status, started_at, completed_at, error_message, created_at, updated_at
+    id, file_id, job_id, converted_file_name, target_format, options, status, started_at, completed_at, error_message, created_at, updated_at, attempts
 `
 
 type UpdateTaskStatusParams struct {
@@ -180,6 +639,7 @@ type UpdateTaskStatusParams struct {
 	CompletedAt       pgtype.Timestamptz
 	ConvertedFileName pgtype.Text
 	ErrorMessage      pgtype.Text
+	Attempts          int32
 }
 
 func (q *Queries) UpdateTaskStatus(ctx context.Context, arg UpdateTaskStatusParams) (Task, error) {
@@ -190,6 +650,7 @@ func (q *Queries) UpdateTaskStatus(ctx context.Context, arg UpdateTaskStatusPara
 		arg.CompletedAt,
 		arg.ConvertedFileName,
 		arg.ErrorMessage,
+		arg.Attempts,
 	)
 	var i Task
 	err := row.Scan(
@@ -198,12 +659,14 @@ func (q *Queries) UpdateTaskStatus(ctx context.Context, arg UpdateTaskStatusPara
 		&i.JobID,
 		&i.ConvertedFileName,
 		&i.TargetFormat,
+		&i.Options,
 		&i.Status,
 		&i.StartedAt,
 		&i.CompletedAt,
 		&i.ErrorMessage,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Attempts,
 	)
 	return i, err
 }
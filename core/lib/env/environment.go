@@ -5,6 +5,8 @@ import (
 	"os"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/meraf00/swytch/core/lib/logger"
@@ -93,3 +95,45 @@ func GetEnvNumber(key string, defaultValue int, required bool) int {
 	}
 	return intValue
 }
+
+// GetEnvStrings retrieves a comma separated list, such as "image,document",
+// with a fallback
+func GetEnvStrings(key string, defaultValue []string, required bool) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		if len(defaultValue) == 0 && required {
+			panic(fmt.Sprintf("Required environment variable %s is undefined and has no default", key))
+		}
+		return defaultValue
+	}
+
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// GetEnvDurations retrieves a comma separated list of durations, such as
+// "10s,1m,10m", with a fallback
+func GetEnvDurations(key string, defaultValue []time.Duration, required bool) []time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		if len(defaultValue) == 0 && required {
+			panic(fmt.Sprintf("Required environment variable %s is undefined and has no default", key))
+		}
+		return defaultValue
+	}
+
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			panic(fmt.Sprintf("Invalid duration list for %s: %s", key, value))
+		}
+		durations = append(durations, d)
+	}
+	return durations
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	appError "github.com/meraf00/swytch/core/lib/apperror"
+	"github.com/meraf00/swytch/core/lib/extension"
+	"github.com/meraf00/swytch/core/lib/respond"
+)
+
+const (
+	MissingTokenError      = "missing_token"
+	InvalidTokenError      = "invalid_token"
+	InsufficientScopeError = "insufficient_scope"
+)
+
+// Authenticator verifies the credential sent with one Authorization scheme.
+// Errors are returned to the client, so they should be app errors.
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (*extension.AuthContext, error)
+}
+
+// Auth dispatches the Authorization header to the authenticator registered
+// for its scheme. Modules may register schemes until the server starts
+// handling requests.
+type Auth struct {
+	mu      sync.RWMutex
+	schemes map[string]Authenticator
+}
+
+func NewAuth() *Auth {
+	return &Auth{
+		schemes: make(map[string]Authenticator),
+	}
+}
+
+// Register handles the scheme, compared case-insensitively, with a.
+func (au *Auth) Register(scheme string, a Authenticator) {
+	au.mu.Lock()
+	defer au.mu.Unlock()
+	au.schemes[strings.ToLower(scheme)] = a
+}
+
+// Middleware rejects requests without valid credentials and stores them
+// with extension.WithAuthContext. When schemes are given, only those are
+// accepted. Since EventSource cannot set headers, a bearer token may also
+// be passed as the access_token query parameter.
+func (au *Auth) Middleware(schemes ...string) mux.MiddlewareFunc {
+	allowed := make(map[string]bool)
+	for _, scheme := range schemes {
+		allowed[strings.ToLower(scheme)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, credential := credentials(r)
+			if credential == "" {
+				respond.Error(w, appError.Unauthorized("missing credentials", MissingTokenError, nil))
+				return
+			}
+
+			au.mu.RLock()
+			authenticator, ok := au.schemes[scheme]
+			au.mu.RUnlock()
+
+			if !ok || (len(allowed) > 0 && !allowed[scheme]) {
+				respond.Error(w, appError.Unauthorized("unsupported authorization scheme", InvalidTokenError, nil))
+				return
+			}
+
+			authCtx, err := authenticator.Authenticate(r.Context(), credential)
+			if err != nil {
+				respond.Error(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(extension.WithAuthContext(r.Context(), authCtx)))
+		})
+	}
+}
+
+// RequireScope rejects requests whose credentials do not grant every one of
+// the scopes. It must run after Middleware.
+func RequireScope(scopes ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authCtx, err := extension.GetAuthContext(r.Context())
+			if err != nil {
+				respond.Error(w, appError.Unauthorized("authentication required", MissingTokenError, nil))
+				return
+			}
+
+			for _, scope := range scopes {
+				if !slices.Contains(authCtx.Credentials.Scope, scope) {
+					respond.Error(w, appError.Forbidden("missing scope "+scope, InsufficientScopeError, nil))
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func credentials(r *http.Request) (string, string) {
+	scheme, credential, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok {
+		return strings.ToLower(scheme), strings.TrimSpace(credential)
+	}
+	return "bearer", r.URL.Query().Get("access_token")
+}
@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	appError "github.com/meraf00/swytch/core/lib/apperror"
+	"github.com/meraf00/swytch/core/lib/extension"
+)
+
+type JWTOptions struct {
+	// HMACKey verifies HS256 tokens. It must be at least MinHMACKeyLength
+	// bytes long.
+	HMACKey []byte
+	// DisableHMAC rejects HS256 tokens, leaving RS256 through JWKSFile
+	DisableHMAC bool
+	// JWKSFile optionally points to a JSON Web Key Set whose RSA keys
+	// verify RS256 tokens
+	JWKSFile string
+	Issuer   string
+	Audience string
+	// DefaultScopes are granted to tokens without a "scope" or "scp" claim
+	DefaultScopes []string
+}
+
+type JWTVerifier struct {
+	hmacKey       []byte
+	rsaKeys       map[string]*rsa.PublicKey
+	parser        *jwt.Parser
+	defaultScopes []string
+}
+
+// MinHMACKeyLength is the shortest HS256 key accepted, matching the size of
+// the SHA-256 output.
+const MinHMACKeyLength = 32
+
+// weakHMACKeys are placeholder keys found in examples, which anyone could
+// sign tokens with.
+var weakHMACKeys = []string{"jwt-secret", "secret", "changeme", "change-me"}
+
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	var methods []string
+	if !opts.DisableHMAC {
+		if err := checkHMACKey(opts.HMACKey); err != nil {
+			return nil, err
+		}
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+
+	var rsaKeys map[string]*rsa.PublicKey
+	if opts.JWKSFile != "" {
+		keys, err := loadJWKS(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		rsaKeys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("HS256 is disabled and no JWKS file is configured")
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	return &JWTVerifier{
+		hmacKey:       opts.HMACKey,
+		rsaKeys:       rsaKeys,
+		parser:        jwt.NewParser(parserOpts...),
+		defaultScopes: opts.DefaultScopes,
+	}, nil
+}
+
+// Authenticate implements Authenticator for the Bearer scheme.
+func (v *JWTVerifier) Authenticate(_ context.Context, token string) (*extension.AuthContext, error) {
+	authCtx, err := v.Verify(token)
+	if err != nil {
+		return nil, appError.Unauthorized("invalid token: "+err.Error(), InvalidTokenError, nil)
+	}
+	return authCtx, nil
+}
+
+// Verify checks the token signature and registered claims and returns the
+// subject and scopes it grants. Scopes are read from a space separated
+// "scope" claim or a "scp" list, and are the default scopes without either.
+func (v *JWTVerifier) Verify(tokenString string) (*extension.AuthContext, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(tokenString, claims, v.key); err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil {
+		return nil, err
+	}
+	if subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	authCtx := &extension.AuthContext{}
+	authCtx.Credentials.UID = subject
+	scopes, ok := scopesFromClaims(claims)
+	if !ok {
+		scopes = slices.Clone(v.defaultScopes)
+	}
+	authCtx.Credentials.Scope = scopes
+	authCtx.Artifacts.AccessToken = tokenString
+
+	return authCtx, nil
+}
+
+func (v *JWTVerifier) key(token *jwt.Token) (any, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return v.hmacKey, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := v.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		// A key set with a single key may be used without key IDs
+		if kid == "" && len(v.rsaKeys) == 1 {
+			for _, key := range v.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+func checkHMACKey(key []byte) error {
+	if len(key) == 0 {
+		return errors.New("HS256 key is empty")
+	}
+	if slices.Contains(weakHMACKeys, string(key)) {
+		return errors.New("HS256 key is a well-known placeholder")
+	}
+	if len(key) < MinHMACKeyLength {
+		return fmt.Errorf("HS256 key must be at least %d bytes", MinHMACKeyLength)
+	}
+	return nil
+}
+
+// scopesFromClaims returns the scopes of the claims and whether they have
+// a scope claim at all.
+func scopesFromClaims(claims jwt.MapClaims) ([]string, bool) {
+	if scope, ok := claims["scope"].(string); ok {
+		return strings.Fields(scope), true
+	}
+
+	scp, ok := claims["scp"].([]any)
+	if !ok {
+		return nil, false
+	}
+
+	var scopes []string
+	for _, s := range scp {
+		if s, ok := s.(string); ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, true
+}
+
+func loadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus for key %q: %w", k.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent for key %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS file contains no RSA signing keys")
+	}
+	return keys, nil
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testHMACKey = []byte("0123456789abcdef0123456789abcdef")
+
+func signToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	claims["sub"] = "user-1"
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(testHMACKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestVerifyScopes(t *testing.T) {
+	defaults := []string{"jobs:read", "jobs:write"}
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"scope claim", jwt.MapClaims{"scope": "files:read jobs:read"}, []string{"files:read", "jobs:read"}},
+		{"scp claim", jwt.MapClaims{"scp": []any{"jobs:write"}}, []string{"jobs:write"}},
+		{"no scope claim", jwt.MapClaims{}, defaults},
+		{"empty scope claim", jwt.MapClaims{"scope": ""}, nil},
+	}
+
+	v, err := NewJWTVerifier(JWTOptions{HMACKey: testHMACKey, DefaultScopes: defaults})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authCtx, err := v.Verify(signToken(t, tt.claims))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got := authCtx.Credentials.Scope; !slices.Equal(got, tt.want) {
+				t.Errorf("scopes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults []string
+		claims   jwt.MapClaims
+		want     int
+	}{
+		{"granted scope", nil, jwt.MapClaims{"scope": "jobs:read"}, http.StatusOK},
+		{"other scope", nil, jwt.MapClaims{"scope": "files:read"}, http.StatusForbidden},
+		{"no scope claim without defaults", nil, jwt.MapClaims{}, http.StatusForbidden},
+		{"no scope claim with defaults", []string{"jobs:read"}, jwt.MapClaims{}, http.StatusOK},
+		{"empty scope claim with defaults", []string{"jobs:read"}, jwt.MapClaims{"scope": ""}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewJWTVerifier(JWTOptions{HMACKey: testHMACKey, DefaultScopes: tt.defaults})
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := NewAuth()
+			auth.Register("Bearer", v)
+
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			handler := auth.Middleware()(RequireScope("jobs:read")(ok))
+
+			req := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			req.Header.Set("Authorization", "Bearer "+signToken(t, tt.claims))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type shutdownKey struct{}
+
+// ShutdownMiddleware makes shutdownCtx, which is cancelled once the server
+// starts shutting down, available to StreamContext.
+func ShutdownMiddleware(shutdownCtx context.Context) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), shutdownKey{}, shutdownCtx)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// StreamContext returns the request's context, also cancelled when the
+// server starts shutting down. Handlers that stream until the client leaves
+// use it, as http.Server.Shutdown waits for them but does not cancel them.
+func StreamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+
+	shutdownCtx, ok := r.Context().Value(shutdownKey{}).(context.Context)
+	if !ok {
+		return ctx, cancel
+	}
+
+	stop := context.AfterFunc(shutdownCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
@@ -0,0 +1,21 @@
+package validation
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ParseTime parses an RFC 3339 timestamp taken from a query string. A "+"
+// offset sent without percent-encoding decodes to a space, so a space is
+// read as "+".
+func ParseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339, strings.Replace(value, " ", "+", 1))
+}
+
+// isRFC3339 backs the "rfc3339" tag, accepting what ParseTime accepts.
+func isRFC3339(fl validator.FieldLevel) bool {
+	_, err := ParseTime(fl.Field().String())
+	return err == nil
+}
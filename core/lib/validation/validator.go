@@ -3,6 +3,7 @@ package validation
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 
@@ -32,12 +33,25 @@ type Validator struct {
 }
 
 func NewValidator(schemas ValidationSchemas) *Validator {
+	validate := validator.New()
+	validate.RegisterValidation("rfc3339", isRFC3339)
+
 	return &Validator{
-		validate: validator.New(),
+		validate: validate,
 		schemas:  schemas,
 	}
 }
 
+// queryDecodeError reports query values that do not fit their field, such
+// as a repeated parameter where one value is expected.
+func queryDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return appError.BadRequest(fmt.Sprintf("Query parameter '%s' must be a single %s", typeErr.Field, typeErr.Type), QueryValidationError, nil)
+	}
+	return appError.BadRequest("Invalid query parameters", QueryValidationError, nil)
+}
+
 func (v *Validator) GetBody(r *http.Request) (any, error) {
 	if v.schemas.Body == nil {
 		var body map[string]any
@@ -114,7 +128,7 @@ func (v *Validator) GetQuery(r *http.Request) (any, error) {
 	}
 
 	if err := json.Unmarshal(data, v.schemas.Query); err != nil {
-		return nil, err
+		return nil, queryDecodeError(err)
 	}
 
 	if err := v.validate.Struct(v.schemas.Query); err != nil {
@@ -145,7 +159,7 @@ func (v *Validator) BindAndValidateQuery(r *http.Request, target any) error {
 	}
 
 	if err := json.Unmarshal(data, target); err != nil {
-		return err
+		return queryDecodeError(err)
 	}
 
 	if err := v.validate.Struct(target); err != nil {
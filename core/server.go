@@ -2,6 +2,7 @@ package core
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"net/http"
 	"time"
@@ -16,7 +17,10 @@ type Server struct {
 	RootRouter *mux.Router
 	ApiRouter  *mux.Router
 	AuthRouter *mux.Router
+	Auth       *middleware.Auth
 	Started    chan struct{}
+	// DebugServer serves expvar on its own listener, nil when disabled
+	DebugServer *http.Server
 }
 
 func NewServer(config *AppConfig, log logger.Log) (*Server, func()) {
@@ -33,6 +37,26 @@ func NewServer(config *AppConfig, log logger.Log) (*Server, func()) {
 	logOpts := middleware.DefaultLoggerOptions()
 	router.Use(middleware.HTTPLoggerMiddleware(log, logOpts))
 
+	// Streams end when shutdown starts instead of holding it up
+	streamsCtx, stopStreams := context.WithCancel(context.Background())
+	router.Use(middleware.ShutdownMiddleware(streamsCtx))
+
+	jwtVerifier, err := middleware.NewJWTVerifier(middleware.JWTOptions{
+		HMACKey:     []byte(config.Encryption.JWTKey),
+		DisableHMAC: !config.Encryption.JWTHMAC,
+		JWKSFile:    config.Encryption.JWKSFile,
+		Issuer:      config.Encryption.JWTIssuer,
+		Audience:    config.Encryption.JWTAudience,
+		// Tokens issued before scopes were enforced carry none
+		DefaultScopes: config.Encryption.JWTDefaultScopes,
+	})
+	if err != nil {
+		log.Fatalf("Failed to initialize JWT verifier: %v", err)
+	}
+	auth := middleware.NewAuth()
+	auth.Register("Bearer", jwtVerifier)
+	apiRouter.Use(auth.Middleware())
+
 	// Server
 	server := http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.HTTP.Host, config.HTTP.Port),
@@ -41,24 +65,45 @@ func NewServer(config *AppConfig, log logger.Log) (*Server, func()) {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	server.RegisterOnShutdown(stopStreams)
+
+	var debugServer *http.Server
+	if config.HTTP.DebugAddr != "" {
+		debugRouter := mux.NewRouter()
+		debugRouter.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+		debugServer = &http.Server{
+			Addr:         config.HTTP.DebugAddr,
+			Handler:      debugRouter,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+		}
+	}
 
 	// Graceful shutdown
 	shutdown := func() {
 		log.Info("Shutting down server...")
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
+		if debugServer != nil {
+			debugServer.Shutdown(ctx)
+		}
 		if err := server.Shutdown(ctx); err != nil {
-			log.Fatalf("Server forced to shutdown: %v\n", err)
+			// Keep going so the caller can still release its resources
+			log.Errorf("Server forced to shutdown: %v", err)
+			server.Close()
+			return
 		}
 		log.Info("Server gracefully stopped.")
 	}
 
 	return &Server{
-		HttpServer: &server,
-		RootRouter: router,
-		ApiRouter:  apiRouter,
-		AuthRouter: authRouter,
-		Started:    make(chan struct{}),
+		HttpServer:  &server,
+		RootRouter:  router,
+		ApiRouter:   apiRouter,
+		AuthRouter:  authRouter,
+		Auth:        auth,
+		Started:     make(chan struct{}),
+		DebugServer: debugServer,
 	}, shutdown
 }
 
@@ -73,4 +118,14 @@ func StartServer(server *Server, logger logger.Log) {
 			logger.Fatalf("Error starting server on %v\n", err)
 		}
 	}()
+
+	if server.DebugServer != nil {
+		go func() {
+			logger.Infof("Starting debug server on %s", server.DebugServer.Addr)
+
+			if err := server.DebugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("Error starting debug server: %v", err)
+			}
+		}()
+	}
 }
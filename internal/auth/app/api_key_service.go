@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/meraf00/swytch/core/lib/apperror"
+	"github.com/meraf00/swytch/core/lib/extension"
+	"github.com/meraf00/swytch/internal/auth/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Verified keys are cached so bcrypt, which is slow by design, runs at most
+// once per key and interval on each instance. A key revoked on another
+// instance keeps working here until its entry expires.
+const apiKeyCacheTTL = time.Minute
+
+var errInvalidAPIKey = apperror.Unauthorized("invalid api key", "invalid_api_key", nil)
+
+type CreateAPIKeyParams struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+type cachedAPIKey struct {
+	key   *domain.APIKey
+	until time.Time
+}
+
+type APIKeyService struct {
+	repo     domain.APIKeyRepository
+	hashCost int
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]cachedAPIKey
+}
+
+func NewAPIKeyService(repo domain.APIKeyRepository, hashCost int) *APIKeyService {
+	return &APIKeyService{
+		repo:     repo,
+		hashCost: hashCost,
+		cache:    make(map[[sha256.Size]byte]cachedAPIKey),
+	}
+}
+
+// CreateAPIKey issues a key owned by the caller. Keys can only carry scopes
+// the caller holds. The returned plaintext key is not stored and cannot be
+// retrieved again.
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, params *CreateAPIKeyParams) (*domain.APIKey, string, error) {
+	authCtx, err := extension.GetAuthContext(ctx)
+	if err != nil {
+		return nil, "", apperror.Unauthorized("authentication required", "", nil)
+	}
+
+	for _, scope := range params.Scopes {
+		if !slices.Contains(authCtx.Credentials.Scope, scope) {
+			return nil, "", apperror.Forbidden("cannot grant scope "+scope, "", nil)
+		}
+	}
+
+	if !params.ExpiresAt.IsZero() && !params.ExpiresAt.After(time.Now()) {
+		return nil, "", apperror.BadRequest("expires_at must be in the future", "", nil)
+	}
+
+	prefix, secret, plaintext, err := domain.NewAPIKeySecret()
+	if err != nil {
+		return nil, "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), s.hashCost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scopes := params.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	key, err := s.repo.CreateAPIKey(ctx, &domain.APIKey{
+		OwnerID:   authCtx.Credentials.UID,
+		Name:      params.Name,
+		Prefix:    prefix,
+		Hash:      string(hash),
+		Scopes:    scopes,
+		ExpiresAt: params.ExpiresAt,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return key, plaintext, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	authCtx, err := extension.GetAuthContext(ctx)
+	if err != nil {
+		return nil, apperror.Unauthorized("authentication required", "", nil)
+	}
+
+	return s.repo.GetAPIKeysByOwner(ctx, authCtx.Credentials.UID)
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, keyID string) (*domain.APIKey, error) {
+	authCtx, err := extension.GetAuthContext(ctx)
+	if err != nil {
+		return nil, apperror.Unauthorized("authentication required", "", nil)
+	}
+
+	key, err := s.repo.RevokeAPIKey(ctx, authCtx.Credentials.UID, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	for digest, entry := range s.cache {
+		if entry.key.ID == key.ID {
+			delete(s.cache, digest)
+		}
+	}
+	s.mu.Unlock()
+
+	return key, nil
+}
+
+// Authenticate implements middleware.Authenticator for the ApiKey scheme.
+// The key's owner becomes the caller and its scopes the granted scopes.
+func (s *APIKeyService) Authenticate(ctx context.Context, credential string) (*extension.AuthContext, error) {
+	now := time.Now()
+	digest := sha256.Sum256([]byte(credential))
+
+	s.mu.Lock()
+	entry, ok := s.cache[digest]
+	if ok && !now.Before(entry.until) {
+		delete(s.cache, digest)
+		ok = false
+	}
+	s.mu.Unlock()
+
+	if ok && entry.key.IsActive(now) {
+		return apiKeyAuthContext(entry.key), nil
+	}
+
+	prefix, secret, ok := domain.ParseAPIKey(credential)
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+
+	key, err := s.repo.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		var appErr *apperror.AppError
+		if errors.As(err, &appErr) && appErr.Type == apperror.NotFoundError {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(key.Hash), []byte(secret)); err != nil {
+		return nil, errInvalidAPIKey
+	}
+
+	if !key.IsActive(now) {
+		return nil, apperror.Unauthorized("api key is revoked or expired", "inactive_api_key", nil)
+	}
+
+	if err := s.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.cache[digest] = cachedAPIKey{key: key, until: now.Add(apiKeyCacheTTL)}
+	s.mu.Unlock()
+
+	return apiKeyAuthContext(key), nil
+}
+
+func apiKeyAuthContext(key *domain.APIKey) *extension.AuthContext {
+	authCtx := &extension.AuthContext{}
+	authCtx.Credentials.UID = key.OwnerID
+	authCtx.Credentials.Scope = key.Scopes
+	return authCtx
+}
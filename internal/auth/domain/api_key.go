@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// API keys look like swk_<prefix>_<secret>. The prefix is stored in clear
+// to find the key, the secret only as a hash.
+const apiKeyTag = "swk"
+
+type APIKey struct {
+	ID         string
+	OwnerID    string
+	Name       string
+	Prefix     string
+	Hash       string
+	Scopes     []string
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+	CreatedAt  time.Time
+}
+
+// IsActive reports whether the key may still be used at the given time.
+func (k *APIKey) IsActive(now time.Time) bool {
+	if !k.RevokedAt.IsZero() {
+		return false
+	}
+	return k.ExpiresAt.IsZero() || now.Before(k.ExpiresAt)
+}
+
+// NewAPIKeySecret generates a key, returning its lookup prefix, the secret
+// part to hash and the full key handed to the client.
+func NewAPIKeySecret() (prefix, secret, key string, err error) {
+	p := make([]byte, 8)
+	if _, err := rand.Read(p); err != nil {
+		return "", "", "", err
+	}
+
+	s := make([]byte, 32)
+	if _, err := rand.Read(s); err != nil {
+		return "", "", "", err
+	}
+
+	prefix = hex.EncodeToString(p)
+	secret = hex.EncodeToString(s)
+	return prefix, secret, apiKeyTag + "_" + prefix + "_" + secret, nil
+}
+
+// ParseAPIKey splits a key into its prefix and secret.
+func ParseAPIKey(key string) (prefix, secret string, ok bool) {
+	parts := strings.Split(key, "_")
+	if len(parts) != 3 || parts[0] != apiKeyTag || parts[1] == "" || parts[2] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
@@ -0,0 +1,11 @@
+package domain
+
+import "context"
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *APIKey) (*APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	GetAPIKeysByOwner(ctx context.Context, ownerID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, ownerID, keyID string) (*APIKey, error)
+	TouchAPIKey(ctx context.Context, keyID string) error
+}
@@ -0,0 +1,123 @@
+package infra
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/apperror"
+	"github.com/meraf00/swytch/core/lib/hashids"
+	"github.com/meraf00/swytch/internal/auth/domain"
+)
+
+var errAPIKeyNotFound = apperror.NotFound("api key not found", "api_key_not_found", nil)
+
+type APIKeyRepositoryPG struct {
+	db core.Database
+	hs hashids.HashID
+}
+
+func NewAPIKeyRepositoryPG(db core.Database, hs hashids.HashID) *APIKeyRepositoryPG {
+	return &APIKeyRepositoryPG{
+		db: db,
+		hs: hs,
+	}
+}
+
+func (r *APIKeyRepositoryPG) CreateAPIKey(ctx context.Context, key *domain.APIKey) (*domain.APIKey, error) {
+	k, err := r.db.Queries().CreateApiKey(ctx, sql.CreateApiKeyParams{
+		OwnerID:   key.OwnerID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		KeyHash:   key.Hash,
+		Scopes:    key.Scopes,
+		ExpiresAt: db.ToPGTimestamptz(key.ExpiresAt),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.toDomain(k)
+}
+
+func (r *APIKeyRepositoryPG) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*domain.APIKey, error) {
+	k, err := r.db.Queries().GetApiKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	return r.toDomain(k)
+}
+
+func (r *APIKeyRepositoryPG) GetAPIKeysByOwner(ctx context.Context, ownerID string) ([]domain.APIKey, error) {
+	rows, err := r.db.Queries().GetApiKeysByOwnerID(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]domain.APIKey, len(rows))
+	for i, row := range rows {
+		k, err := r.toDomain(row)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = *k
+	}
+
+	return keys, nil
+}
+
+func (r *APIKeyRepositoryPG) RevokeAPIKey(ctx context.Context, ownerID, keyID string) (*domain.APIKey, error) {
+	keyIDInt, err := r.hs.DecodeID(keyID)
+	if err != nil {
+		return nil, errAPIKeyNotFound
+	}
+
+	k, err := r.db.Queries().RevokeApiKey(ctx, sql.RevokeApiKeyParams{
+		ID:      int32(keyIDInt),
+		OwnerID: ownerID,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	return r.toDomain(k)
+}
+
+func (r *APIKeyRepositoryPG) TouchAPIKey(ctx context.Context, keyID string) error {
+	keyIDInt, err := r.hs.DecodeID(keyID)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Queries().TouchApiKey(ctx, int32(keyIDInt))
+}
+
+func (r *APIKeyRepositoryPG) toDomain(k sql.ApiKey) (*domain.APIKey, error) {
+	id, err := r.hs.EncodeID(uint(k.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.APIKey{
+		ID:         id,
+		OwnerID:    k.OwnerID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Hash:       k.KeyHash,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt.Time,
+		LastUsedAt: k.LastUsedAt.Time,
+		RevokedAt:  k.RevokedAt.Time,
+		CreatedAt:  k.CreatedAt.Time,
+	}, nil
+}
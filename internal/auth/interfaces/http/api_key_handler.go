@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/meraf00/swytch/core/lib/respond"
+	"github.com/meraf00/swytch/core/lib/validation"
+	"github.com/meraf00/swytch/internal/auth/app"
+	"github.com/meraf00/swytch/internal/auth/domain"
+)
+
+type apiKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func toAPIKeyResponse(key *domain.APIKey) apiKeyResponse {
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	return apiKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		ExpiresAt:  optional(key.ExpiresAt),
+		LastUsedAt: optional(key.LastUsedAt),
+		RevokedAt:  optional(key.RevokedAt),
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// Create an API key for the caller. The key is only ever shown in this
+// response.
+func HandleCreateAPIKey(s *app.APIKeyService) http.HandlerFunc {
+	type createAPIKeyRequest struct {
+		Name      string     `json:"name" validate:"required,max=255"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	type response struct {
+		apiKeyResponse
+		Key string `json:"key"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Body: &createAPIKeyRequest{},
+		})
+
+		body, err := validator.GetBody(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*createAPIKeyRequest)
+
+		params := &app.CreateAPIKeyParams{
+			Name:   req.Name,
+			Scopes: req.Scopes,
+		}
+		if req.ExpiresAt != nil {
+			params.ExpiresAt = *req.ExpiresAt
+		}
+
+		key, plaintext, err := s.CreateAPIKey(ctx, params)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, &response{
+			apiKeyResponse: toAPIKeyResponse(key),
+			Key:            plaintext,
+		})
+	}
+}
+
+// List the caller's API keys, including revoked ones
+func HandleListAPIKeys(s *app.APIKeyService) http.HandlerFunc {
+	type response struct {
+		APIKeys []apiKeyResponse `json:"api_keys"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := s.ListAPIKeys(r.Context())
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := make([]apiKeyResponse, len(keys))
+		for i := range keys {
+			res[i] = toAPIKeyResponse(&keys[i])
+		}
+
+		respond.JSON(w, http.StatusOK, &response{
+			APIKeys: res,
+		})
+	}
+}
+
+// Revoke one of the caller's API keys
+func HandleRevokeAPIKey(s *app.APIKeyService) http.HandlerFunc {
+	type revokeAPIKeyRequest struct {
+		ID string `json:"key_id" validate:"required"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &revokeAPIKeyRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*revokeAPIKeyRequest)
+
+		key, err := s.RevokeAPIKey(ctx, req.ID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, toAPIKeyResponse(key))
+	}
+}
@@ -0,0 +1,13 @@
+package internal
+
+// Converters register themselves with the domain registry on import. Both
+// the API and the worker link the same set so that job validation matches
+// what workers can actually run. Converters relying on external tools only
+// register when the tool is installed, so the API and worker hosts need the
+// same tools: rendering PDF pages to images needs pdftoppm (poppler-utils).
+import (
+	_ "github.com/meraf00/swytch/internal/pipeline/infra/converter/passthrough"
+	_ "github.com/meraf00/swytch/internal/pipeline/infra/converter/pdf"
+	_ "github.com/meraf00/swytch/internal/pipeline/infra/converter/raster"
+	_ "github.com/meraf00/swytch/internal/pipeline/infra/converter/svg"
+)
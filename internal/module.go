@@ -1,9 +1,15 @@
 package internal
 
 import (
+	"expvar"
+
 	"github.com/meraf00/swytch/core"
 	"github.com/meraf00/swytch/core/lib/hashids"
 	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/core/lib/middleware"
+	authApp "github.com/meraf00/swytch/internal/auth/app"
+	authInfra "github.com/meraf00/swytch/internal/auth/infra"
+	authHandler "github.com/meraf00/swytch/internal/auth/interfaces/http"
 	"github.com/meraf00/swytch/internal/pipeline/app"
 	"github.com/meraf00/swytch/internal/pipeline/infra"
 	handler "github.com/meraf00/swytch/internal/pipeline/interfaces/http"
@@ -17,26 +23,65 @@ func InitModules(config *core.AppConfig, log logger.Log, server *core.Server, db
 		log.Fatalf("Failed to register auth module:", err)
 	}
 
+	// Auth
+	apiKeyRepo := authInfra.NewAPIKeyRepositoryPG(db, hd)
+	apiKeyService := authApp.NewAPIKeyService(apiKeyRepo, config.Encryption.HashCost)
+	server.Auth.Register("ApiKey", apiKeyService)
+
+	// API keys are managed with user tokens only
+	apiKeyRouter := server.AuthRouter.PathPrefix("/api-keys").Subrouter()
+	apiKeyRouter.Use(server.Auth.Middleware("Bearer"))
+	apiKeyRouter.HandleFunc("", authHandler.HandleCreateAPIKey(apiKeyService)).Methods("POST")
+	apiKeyRouter.HandleFunc("", authHandler.HandleListAPIKeys(apiKeyService)).Methods("GET")
+	apiKeyRouter.HandleFunc("/{key_id}", authHandler.HandleRevokeAPIKey(apiKeyService)).Methods("DELETE")
+
 	// Repositories
-	jobRepo := infra.NewJobRepositoryPG(db, hd)
-	taskRepo := infra.NewTaskRepositoryPG(db, hd)
+	jobRepo := infra.NewJobRepositoryPG(db, hd, config.Broker.TaskQueue)
+	taskRepo := infra.NewTaskRepositoryPG(db, hd, config.Broker.TaskQueue)
+	webhookRepo := infra.NewWebhookRepositoryPG(db, hd)
+	uploadRepo := infra.NewUploadRepositoryPG(db)
+	taskEvents := infra.NewTaskEventsRedis(rdb, log)
+	taskCancellations := infra.NewTaskCancellationsRedis(rdb, log)
 
 	// Services
 	fileService, err := infra.NewMinioFileService(&config.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initiate minio service", err)
 	}
-	conversionService := app.NewConversionService(taskRepo, jobRepo, fileService)
+	conversionService := app.NewConversionService(taskRepo, jobRepo, webhookRepo, uploadRepo, fileService, taskEvents, taskCancellations)
 
 	// API Surface
 	apiRouter := server.ApiRouter
+	filesRead := middleware.RequireScope(handler.ScopeFilesRead)
+	filesWrite := middleware.RequireScope(handler.ScopeFilesWrite)
+	jobsRead := middleware.RequireScope(handler.ScopeJobsRead)
+	jobsWrite := middleware.RequireScope(handler.ScopeJobsWrite)
+	webhooksManage := middleware.RequireScope(handler.ScopeWebhooksManage)
 
 	// Files
-	apiRouter.HandleFunc("/files", handler.HandleGetUploadPresignedURL(fileService)).Methods("POST")
+	apiRouter.Handle("/files", filesWrite(handler.HandleGetUploadPresignedURL(conversionService))).Methods("POST")
+
+	// Conversions
+	apiRouter.HandleFunc("/conversions", handler.HandleGetSupportedConversions(conversionService)).Methods("GET")
 
 	// Jobs and Tasks
-	apiRouter.HandleFunc("/jobs", handler.HandleCreateJob(conversionService)).Methods("POST")
-	apiRouter.HandleFunc("/jobs/{job_id}", handler.HandleGetJob(conversionService)).Methods("GET")
-	apiRouter.HandleFunc("/jobs/{job_id}/tasks", handler.HandleGetJobTasks(conversionService)).Methods("GET")
-	apiRouter.HandleFunc("/tasks/{task_id}/download", handler.HandleGetCompletedTaskDownloadURL(conversionService)).Methods("POST")
+	apiRouter.Handle("/jobs", jobsWrite(handler.HandleCreateJob(conversionService))).Methods("POST")
+	apiRouter.Handle("/jobs", jobsRead(handler.HandleListJobs(conversionService))).Methods("GET")
+	apiRouter.Handle("/jobs/{job_id}", jobsRead(handler.HandleGetJob(conversionService))).Methods("GET")
+	apiRouter.Handle("/jobs/{job_id}/tasks", jobsRead(handler.HandleGetJobTasks(conversionService))).Methods("GET")
+	apiRouter.Handle("/jobs/{job_id}/status", jobsRead(handler.HandleGetJobStatus(conversionService))).Methods("GET")
+	apiRouter.Handle("/jobs/{job_id}/webhooks", jobsRead(handler.HandleGetJobWebhooks(conversionService))).Methods("GET")
+	apiRouter.Handle("/jobs/{job_id}/cancel", jobsWrite(handler.HandleCancelJob(conversionService))).Methods("POST")
+	apiRouter.Handle("/tasks/{task_id}/cancel", jobsWrite(handler.HandleCancelTask(conversionService))).Methods("POST")
+	apiRouter.Handle("/jobs/{job_id}/retry-failed", jobsWrite(handler.HandleRetryFailedTasks(conversionService))).Methods("POST")
+	apiRouter.Handle("/tasks/{task_id}/retry", jobsWrite(handler.HandleRetryTask(conversionService))).Methods("POST")
+	apiRouter.Handle("/tasks/{task_id}/attempts", jobsRead(handler.HandleGetTaskAttempts(conversionService))).Methods("GET")
+	apiRouter.Handle("/tasks/{task_id}/download", filesRead(handler.HandleGetCompletedTaskDownloadURL(conversionService))).Methods("POST")
+
+	// Webhooks
+	apiRouter.Handle("/webhooks/secret", webhooksManage(handler.HandleGetWebhookSecret(conversionService))).Methods("GET")
+	apiRouter.Handle("/webhooks/secret/rotate", webhooksManage(handler.HandleRotateWebhookSecret(conversionService))).Methods("POST")
+
+	// Metrics, served on the debug listener
+	expvar.Publish("task_queue_depth", handler.QueueDepthMetric(conversionService))
 }
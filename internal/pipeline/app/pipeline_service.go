@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/url"
 
+	"github.com/google/uuid"
+	"github.com/meraf00/swytch/core/lib/apperror"
+	"github.com/meraf00/swytch/core/lib/extension"
 	"github.com/meraf00/swytch/internal/pipeline/domain"
 )
 
@@ -13,29 +16,86 @@ type CreateJobParams struct {
 		OriginalName   string
 		OriginalFormat string
 		TargetFormats  []string
+		Options        map[string]string
 	}
+	Merge *MergeParams
+	// CallbackURL receives a POST when each task and the whole job finish,
+	// signed with the owner's webhook secret.
+	CallbackURL string
+	// Priority picks the lane the job's tasks wait in, JobPriorityNormal if
+	// empty.
+	Priority domain.JobPriority
+}
+
+// MergeParams combines every file requesting TargetFormat into one output
+// instead of converting each file on its own.
+type MergeParams struct {
+	TargetFormat string
+	Options      map[string]string
 }
 
 type PipelineService struct {
 	taskRepo    domain.TaskRepository
 	jobRepo     domain.JobRepository
+	webhookRepo domain.WebhookRepository
+	uploadRepo  domain.UploadRepository
 	fileService FileService
+	events      domain.TaskEventBus
+	cancels     domain.TaskCancelSignaler
 }
 
 func NewConversionService(
 	taskRepo domain.TaskRepository,
 	jobRepo domain.JobRepository,
+	webhookRepo domain.WebhookRepository,
+	uploadRepo domain.UploadRepository,
 	fileService FileService,
+	events domain.TaskEventBus,
+	cancels domain.TaskCancelSignaler,
 ) *PipelineService {
 	return &PipelineService{
 		taskRepo:    taskRepo,
 		jobRepo:     jobRepo,
+		webhookRepo: webhookRepo,
+		uploadRepo:  uploadRepo,
 		fileService: fileService,
+		events:      events,
+		cancels:     cancels,
 	}
 }
 
+// CreateUpload names a new object for the caller to upload originalName to
+// and returns it with a presigned PUT URL.
+func (cs *PipelineService) CreateUpload(ctx context.Context, originalName string) (*domain.Upload, *url.URL, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	upload, err := cs.uploadRepo.CreateUpload(ctx, &domain.Upload{
+		ObjectName:   uuid.New().String(),
+		OwnerID:      ownerID,
+		OriginalName: originalName,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	uploadURL, err := cs.fileService.GenerateUploadUrl(ctx, upload.ObjectName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return upload, uploadURL, nil
+}
+
 func (cs *PipelineService) GenerateTaskDownloadUrl(ctx context.Context, taskID string) (*url.URL, error) {
-	task, err := cs.taskRepo.GetTaskByID(ctx, taskID)
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := cs.taskRepo.GetTaskByID(ctx, ownerID, taskID)
 	if err != nil {
 		return nil, err
 	}
@@ -43,47 +103,284 @@ func (cs *PipelineService) GenerateTaskDownloadUrl(ctx context.Context, taskID s
 	return cs.fileService.GenerateDownloadUrl(ctx, task.ConvertedFileName)
 }
 
-func (cs *PipelineService) CreateJob(ctx context.Context, job *CreateJobParams) (string, error) {
+func (cs *PipelineService) CreateJob(ctx context.Context, job *CreateJobParams) (*domain.Job, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var tasks []domain.Task
+	var mergeFiles []domain.File
 
 	for _, file := range job.Files {
 		for _, format := range file.TargetFormats {
-			task, err := domain.NewTask(domain.File{
+			source := domain.File{
 				ObjectName:     file.ObjectName,
 				OriginalName:   file.OriginalName,
 				OriginalFormat: file.OriginalFormat,
-			}, format)
+			}
+
+			if job.Merge != nil && format == job.Merge.TargetFormat {
+				mergeFiles = append(mergeFiles, source)
+				continue
+			}
+
+			task, err := domain.NewTask(source, format, file.Options)
 
 			if err != nil {
-				return "", err
+				return nil, err
 			}
 			tasks = append(tasks, domain.Task{
 				File:         task.File,
 				TargetFormat: task.TargetFormat,
+				Options:      task.Options,
 			})
 		}
 	}
 
-	newJob, err := cs.jobRepo.CreateJob(ctx, &domain.Job{
-		Tasks: tasks,
+	if job.Merge != nil {
+		task, err := domain.NewMergedTask(mergeFiles, job.Merge.TargetFormat, job.Merge.Options)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, domain.Task{
+			File:         task.File,
+			Inputs:       task.Inputs,
+			TargetFormat: task.TargetFormat,
+			Options:      task.Options,
+		})
+	}
+
+	if job.CallbackURL != "" {
+		// Deliveries can only be signed once the owner has a secret
+		if _, err := cs.WebhookSecret(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	priority := job.Priority
+	if priority == "" {
+		priority = domain.JobPriorityNormal
+	}
+
+	return cs.jobRepo.CreateJob(ctx, &domain.Job{
+		OwnerID:     ownerID,
+		Priority:    priority,
+		Tasks:       tasks,
+		CallbackURL: job.CallbackURL,
 	})
+}
+
+// QueueDepths returns how many tasks of every owner wait in each priority
+// lane.
+func (cs *PipelineService) QueueDepths(ctx context.Context) (map[domain.JobPriority]int, error) {
+	return cs.taskRepo.CountPendingTasks(ctx)
+}
 
+func (cs *PipelineService) GetJob(ctx context.Context, jobID string) (*domain.Job, error) {
+	ownerID, err := ownerFromContext(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return newJob.ID, nil
+	return cs.jobRepo.GetJobByID(ctx, ownerID, jobID)
 }
 
-func (cs *PipelineService) GetJob(ctx context.Context, jobID string) (*domain.Job, error) {
-	return cs.jobRepo.GetJobByID(ctx, jobID)
+const (
+	defaultJobPageSize = 20
+	maxJobPageSize     = 100
+)
+
+func (cs *PipelineService) ListJobs(ctx context.Context, filter *domain.JobFilter) (*domain.JobPage, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultJobPageSize
+	}
+	filter.Limit = min(filter.Limit, maxJobPageSize)
+
+	return cs.jobRepo.ListJobs(ctx, ownerID, filter)
 }
 
 func (cs *PipelineService) GetJobTasks(ctx context.Context, jobID string) ([]domain.Task, error) {
-	job, err := cs.jobRepo.GetJobWithTasksAndFiles(ctx, jobID)
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := cs.jobRepo.GetJobWithTasksAndFiles(ctx, ownerID, jobID)
 	if err != nil {
 		return nil, err
 	}
 
 	return job.Tasks, nil
 }
+
+// CancelTask stops a task that has not finished yet. A worker converting it
+// is told to give up.
+func (cs *PipelineService) CancelTask(ctx context.Context, taskID string) (*domain.Task, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := cs.taskRepo.CancelTask(ctx, ownerID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	cs.announceCancelled(ctx, task)
+	return task, nil
+}
+
+// CancelJob cancels every unfinished task of a job and returns them.
+func (cs *PipelineService) CancelJob(ctx context.Context, jobID string) ([]domain.Task, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := cs.taskRepo.CancelJobTasks(ctx, ownerID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tasks {
+		cs.announceCancelled(ctx, &tasks[i])
+	}
+	return tasks, nil
+}
+
+// announceCancelled notifies workers and progress listeners. Both are best
+// effort since the cancellation is already persisted.
+func (cs *PipelineService) announceCancelled(ctx context.Context, task *domain.Task) {
+	_ = cs.cancels.SignalTaskCancelled(ctx, task.ID)
+	_ = cs.events.PublishTaskEvent(ctx, domain.NewTaskEvent(task))
+}
+
+// RetryTask queues a failed task again. Its previous attempts are kept.
+func (cs *PipelineService) RetryTask(ctx context.Context, taskID string) (*domain.Task, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	task, err := cs.taskRepo.RetryTask(ctx, ownerID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = cs.events.PublishTaskEvent(ctx, domain.NewTaskEvent(task))
+	return task, nil
+}
+
+// RetryFailedTasks queues every failed task of a job again and returns them.
+func (cs *PipelineService) RetryFailedTasks(ctx context.Context, jobID string) ([]domain.Task, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks, err := cs.taskRepo.RetryJobFailedTasks(ctx, ownerID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range tasks {
+		_ = cs.events.PublishTaskEvent(ctx, domain.NewTaskEvent(&tasks[i]))
+	}
+	return tasks, nil
+}
+
+func (cs *PipelineService) GetTaskAttempts(ctx context.Context, taskID string) ([]domain.TaskAttempt, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return cs.taskRepo.GetTaskAttempts(ctx, ownerID, taskID)
+}
+
+func (cs *PipelineService) GetJobWebhookDeliveries(ctx context.Context, jobID string) ([]domain.WebhookDelivery, error) {
+	if _, err := cs.GetJob(ctx, jobID); err != nil {
+		return nil, err
+	}
+
+	return cs.webhookRepo.GetJobWebhookDeliveries(ctx, jobID)
+}
+
+// WebhookSecret returns the secret the caller's webhooks are signed with,
+// generating it on first use.
+func (cs *PipelineService) WebhookSecret(ctx context.Context) (string, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := domain.NewWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+
+	return cs.webhookRepo.GetOrCreateWebhookSecret(ctx, ownerID, secret)
+}
+
+// RotateWebhookSecret replaces the caller's webhook secret. Deliveries not
+// yet sent are signed with the new one.
+func (cs *PipelineService) RotateWebhookSecret(ctx context.Context) (string, error) {
+	ownerID, err := ownerFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := domain.NewWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+
+	return cs.webhookRepo.RotateWebhookSecret(ctx, ownerID, secret)
+}
+
+// WatchJob subscribes to the task events of a job and returns its tasks as
+// they were after subscribing, so no transition is lost between the two.
+// The caller must close the subscription.
+func (cs *PipelineService) WatchJob(ctx context.Context, jobID string) ([]domain.Task, domain.TaskEventSubscription, error) {
+	// Check access before subscribing to anything
+	if _, err := cs.GetJob(ctx, jobID); err != nil {
+		return nil, nil, err
+	}
+
+	sub, err := cs.events.SubscribeJobEvents(ctx, jobID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks, err := cs.GetJobTasks(ctx, jobID)
+	if err != nil {
+		sub.Close()
+		return nil, nil, err
+	}
+
+	return tasks, sub, nil
+}
+
+func (cs *PipelineService) GetSupportedConversions() map[string][]string {
+	return domain.SupportedConversions()
+}
+
+func (cs *PipelineService) GetSupportedMerges() map[string][]string {
+	return domain.SupportedMerges()
+}
+
+// ownerFromContext returns the authenticated caller, who owns the jobs they
+// create and can only see those.
+func ownerFromContext(ctx context.Context) (string, error) {
+	authCtx, err := extension.GetAuthContext(ctx)
+	if err != nil {
+		return "", apperror.Unauthorized("authentication required", "", nil)
+	}
+	return authCtx.Credentials.UID, nil
+}
@@ -0,0 +1,264 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+type WorkerService struct {
+	taskRepo    domain.TaskRepository
+	fileService FileService
+	events      domain.TaskEventPublisher
+	cancels     domain.TaskCancelWatcher
+	workerID    string
+	lease       time.Duration
+}
+
+func NewWorkerService(
+	taskRepo domain.TaskRepository,
+	fileService FileService,
+	events domain.TaskEventPublisher,
+	cancels domain.TaskCancelWatcher,
+	workerID string,
+	lease time.Duration,
+) *WorkerService {
+	return &WorkerService{
+		taskRepo:    taskRepo,
+		fileService: fileService,
+		events:      events,
+		cancels:     cancels,
+		workerID:    workerID,
+		lease:       lease,
+	}
+}
+
+// ProcessTask downloads the task's source file, converts it and uploads the
+// result, recording progress on the task as it goes. Conversion failures are
+// persisted on the task; the returned error is only non-nil when the task
+// state itself could not be read or written, or when a transient storage
+// failure put the task back to pending because canRetry says the message
+// will be redelivered. Cancelled and finished tasks are skipped, or
+// interrupted if they are cancelled while converting. A task another worker
+// is still processing returns ErrTaskBusy; it can be claimed once that
+// worker's lease ran out if it crashed.
+func (ws *WorkerService) ProcessTask(ctx context.Context, taskID string, canRetry bool) error {
+	// Watch before claiming: a cancellation from here on interrupts the
+	// conversion, an earlier one makes the status updates below fail
+	taskCtx, stop := ws.cancels.WatchTaskCancellation(ctx, taskID)
+	defer stop()
+
+	task, err := ws.taskRepo.ClaimTask(ctx, taskID, ws.workerID, ws.lease)
+	if errors.Is(err, domain.ErrTaskFinished) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ws.publish(ctx, task)
+
+	leaseCtx, stopRenewing := ws.renewLease(taskCtx, task)
+	convertedFileName, convErr := ws.convert(leaseCtx, task)
+	stopRenewing()
+
+	var transient *transientError
+	if canRetry && errors.As(convErr, &transient) && taskCtx.Err() == nil {
+		task, err = ws.taskRepo.RequeueTask(ctx, task, convErr.Error())
+		if errors.Is(err, domain.ErrTaskCancelled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		ws.publish(ctx, task)
+		return convErr
+	}
+
+	if convErr != nil {
+		task.Fail(convErr.Error())
+	} else {
+		task.Complete(convertedFileName)
+	}
+
+	task, err = ws.taskRepo.UpdateTaskStatus(ctx, task)
+	if errors.Is(err, domain.ErrTaskCancelled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	ws.publish(ctx, task)
+
+	return nil
+}
+
+// Lease is how long a task this worker stopped renewing stays claimed.
+func (ws *WorkerService) Lease() time.Duration {
+	return ws.lease
+}
+
+// renewLease renews the lease on task until the returned stop is called.
+// The returned context is cancelled when the lease is lost, as the task then
+// belongs to another worker or was cancelled.
+func (ws *WorkerService) renewLease(ctx context.Context, task *domain.Task) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(ws.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := ws.taskRepo.RenewTaskLease(ctx, task)
+			if errors.Is(err, domain.ErrTaskCancelled) {
+				cancel()
+				return
+			}
+			// Other failures are retried on the next tick, well within
+			// the lease
+		}
+	}()
+
+	return ctx, func() {
+		cancel()
+		<-done
+	}
+}
+
+// publish announces a status change. Events are best effort: the status is
+// already persisted, so listeners that miss one still see it on reload.
+func (ws *WorkerService) publish(ctx context.Context, task *domain.Task) {
+	_ = ws.events.PublishTaskEvent(ctx, domain.NewTaskEvent(task))
+}
+
+func (ws *WorkerService) convert(ctx context.Context, task *domain.Task) (string, error) {
+	workDir, err := os.MkdirTemp("", "swytch-task-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	sources := task.Sources()
+	srcPaths := make([]string, len(sources))
+	for i, file := range sources {
+		srcPaths[i] = filepath.Join(workDir, fmt.Sprintf("source-%d.%s", i, file.OriginalFormat))
+		if err := ws.fileService.DownloadFile(ctx, file.ObjectName, srcPaths[i]); err != nil {
+			return "", &transientError{fmt.Errorf("failed to download source file: %w", err)}
+		}
+	}
+
+	format := outputFormat(task)
+	dstPath := filepath.Join(workDir, "converted."+format)
+	if err := ws.runConverter(ctx, task, srcPaths, dstPath); err != nil {
+		return "", fmt.Errorf("conversion failed: %w", err)
+	}
+
+	objectName := uuid.New().String() + "." + format
+	contentType := mime.TypeByExtension("." + format)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if err := ws.fileService.UploadFile(ctx, objectName, dstPath, contentType); err != nil {
+		return "", &transientError{fmt.Errorf("failed to upload converted file: %w", err)}
+	}
+
+	return objectName, nil
+}
+
+// transientError marks a failure that may succeed on a later attempt, such
+// as object storage being briefly unreachable.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string { return e.err.Error() }
+
+func (e *transientError) Unwrap() error { return e.err }
+
+// outputFormat is the format of the uploaded result, which differs from the
+// target format when a converter packs several outputs into an archive.
+func outputFormat(task *domain.Task) string {
+	var impl any
+	if task.IsMerge() {
+		impl, _ = domain.LookupMerger(task.TargetFormat)
+	} else {
+		impl, _ = domain.LookupConverter(task.File.OriginalFormat, task.TargetFormat)
+	}
+
+	if f, ok := impl.(domain.OutputFormatter); ok {
+		return f.OutputFormat(task.Options)
+	}
+	return task.TargetFormat
+}
+
+func (ws *WorkerService) runConverter(ctx context.Context, task *domain.Task, srcPaths []string, dstPath string) error {
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return err
+	}
+
+	if task.IsMerge() {
+		err = ws.merge(ctx, task, srcPaths, dst)
+	} else {
+		err = ws.convertOne(ctx, task, srcPaths[0], dst)
+	}
+
+	if err != nil {
+		dst.Close()
+		return err
+	}
+
+	return dst.Close()
+}
+
+func (ws *WorkerService) convertOne(ctx context.Context, task *domain.Task, srcPath string, dst io.Writer) error {
+	converter, ok := domain.LookupConverter(task.File.OriginalFormat, task.TargetFormat)
+	if !ok {
+		return fmt.Errorf("no converter available for %s to %s", task.File.OriginalFormat, task.TargetFormat)
+	}
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return converter.Convert(ctx, src, dst, task.Options)
+}
+
+func (ws *WorkerService) merge(ctx context.Context, task *domain.Task, srcPaths []string, dst io.Writer) error {
+	merger, ok := domain.LookupMerger(task.TargetFormat)
+	if !ok {
+		return fmt.Errorf("no merger available for %s", task.TargetFormat)
+	}
+
+	sources := make([]domain.Source, len(srcPaths))
+	for i, path := range srcPaths {
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		sources[i] = domain.Source{Format: task.Inputs[i].OriginalFormat, Reader: src}
+	}
+
+	return merger.Merge(ctx, sources, dst, task.Options)
+}
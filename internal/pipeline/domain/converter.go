@@ -0,0 +1,205 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+)
+
+// ConversionOptions are converter specific settings such as width or quality.
+type ConversionOptions map[string]string
+
+type Converter interface {
+	SourceFormat() string
+	TargetFormat() string
+	Convert(ctx context.Context, in io.Reader, out io.Writer, opts ConversionOptions) error
+}
+
+// Source is one input of a merge.
+type Source struct {
+	Format string
+	Reader io.Reader
+}
+
+// Merger combines several sources, in order, into a single output.
+type Merger interface {
+	SourceFormats() []string
+	TargetFormat() string
+	Merge(ctx context.Context, sources []Source, out io.Writer, opts ConversionOptions) error
+}
+
+// OptionsValidator is implemented by converters that can reject invalid
+// options before a task is created.
+type OptionsValidator interface {
+	ValidateOptions(opts ConversionOptions) error
+}
+
+// OutputFormatter is implemented by converters whose output container
+// depends on the options, such as a zip of pages instead of a single image.
+type OutputFormatter interface {
+	OutputFormat(opts ConversionOptions) string
+}
+
+// DefaultConverterClass is the class of converters and mergers that do not
+// implement Classifier.
+const DefaultConverterClass = "default"
+
+// Classifier is implemented by converters and mergers that run in a
+// dedicated worker pool, such as "image" or "document", so heavy
+// conversions do not hold up cheap ones.
+type Classifier interface {
+	Class() string
+}
+
+// ConverterClass returns the class of a converter or merger.
+func ConverterClass(impl any) string {
+	if c, ok := impl.(Classifier); ok {
+		return c.Class()
+	}
+	return DefaultConverterClass
+}
+
+type conversion struct {
+	source string
+	target string
+}
+
+type ConverterRegistry struct {
+	mu         sync.RWMutex
+	converters map[conversion]Converter
+	mergers    map[string]Merger
+}
+
+func NewConverterRegistry() *ConverterRegistry {
+	return &ConverterRegistry{
+		converters: make(map[conversion]Converter),
+		mergers:    make(map[string]Merger),
+	}
+}
+
+func (r *ConverterRegistry) Register(c Converter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := conversion{source: c.SourceFormat(), target: c.TargetFormat()}
+	if _, exists := r.converters[key]; exists {
+		return fmt.Errorf("converter for %s to %s already registered", key.source, key.target)
+	}
+
+	r.converters[key] = c
+	return nil
+}
+
+func (r *ConverterRegistry) Lookup(sourceFormat, targetFormat string) (Converter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.converters[conversion{source: sourceFormat, target: targetFormat}]
+	return c, ok
+}
+
+func (r *ConverterRegistry) RegisterMerger(m Merger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.mergers[m.TargetFormat()]; exists {
+		return fmt.Errorf("merger for %s already registered", m.TargetFormat())
+	}
+
+	r.mergers[m.TargetFormat()] = m
+	return nil
+}
+
+func (r *ConverterRegistry) LookupMerger(targetFormat string) (Merger, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.mergers[targetFormat]
+	return m, ok
+}
+
+// Conversions returns the supported target formats keyed by source format.
+func (r *ConverterRegistry) Conversions() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	conversions := make(map[string][]string)
+	for key := range r.converters {
+		conversions[key.source] = append(conversions[key.source], key.target)
+	}
+	for _, targets := range conversions {
+		slices.Sort(targets)
+	}
+
+	return conversions
+}
+
+// Merges returns the accepted source formats keyed by merge target format.
+func (r *ConverterRegistry) Merges() map[string][]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	merges := make(map[string][]string, len(r.mergers))
+	for target, m := range r.mergers {
+		merges[target] = slices.Sorted(slices.Values(m.SourceFormats()))
+	}
+
+	return merges
+}
+
+// Classes returns the classes of all converters and mergers.
+func (r *ConverterRegistry) Classes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var classes []string
+	for _, c := range r.converters {
+		classes = append(classes, ConverterClass(c))
+	}
+	for _, m := range r.mergers {
+		classes = append(classes, ConverterClass(m))
+	}
+	slices.Sort(classes)
+
+	return slices.Compact(classes)
+}
+
+var converters = NewConverterRegistry()
+
+// RegisterConverter adds c to the converters available to this build.
+// Converter packages call it from init and it panics on duplicates.
+func RegisterConverter(c Converter) {
+	if err := converters.Register(c); err != nil {
+		panic(err)
+	}
+}
+
+func LookupConverter(sourceFormat, targetFormat string) (Converter, bool) {
+	return converters.Lookup(sourceFormat, targetFormat)
+}
+
+// RegisterMerger adds m to the mergers available to this build. Like
+// RegisterConverter it is meant for init and panics on duplicates.
+func RegisterMerger(m Merger) {
+	if err := converters.RegisterMerger(m); err != nil {
+		panic(err)
+	}
+}
+
+func LookupMerger(targetFormat string) (Merger, bool) {
+	return converters.LookupMerger(targetFormat)
+}
+
+func SupportedConversions() map[string][]string {
+	return converters.Conversions()
+}
+
+func SupportedMerges() map[string][]string {
+	return converters.Merges()
+}
+
+func ConverterClasses() []string {
+	return converters.Classes()
+}
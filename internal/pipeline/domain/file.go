@@ -7,6 +7,16 @@ type File struct {
 	ObjectName     string
 	OriginalName   string
 	OriginalFormat string
+	OwnerID        string
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
+
+// Upload is an object name handed to an owner for uploading a source file.
+// Jobs may only convert objects uploaded by their owner.
+type Upload struct {
+	ObjectName   string
+	OwnerID      string
+	OriginalName string
+	CreatedAt    time.Time
+}
@@ -6,3 +6,7 @@ type FileRepository interface {
 	GetFileByID(ctx context.Context, fileID string) (*File, error)
 	CreateFile(ctx context.Context, file *File) (*File, error)
 }
+
+type UploadRepository interface {
+	CreateUpload(ctx context.Context, upload *Upload) (*Upload, error)
+}
@@ -2,9 +2,63 @@ package domain
 
 import "time"
 
+// JobStatus summarizes the statuses of a job's tasks.
+type JobStatus string
+
+const (
+	JobStatusPending         JobStatus = "pending"
+	JobStatusRunning         JobStatus = "running"
+	JobStatusCompleted       JobStatus = "completed"
+	JobStatusFailed          JobStatus = "failed"
+	JobStatusPartiallyFailed JobStatus = "partially_failed"
+	JobStatusCancelled       JobStatus = "cancelled"
+)
+
+// TaskCounts tallies a job's tasks by status.
+type TaskCounts struct {
+	Total      int
+	Pending    int
+	Processing int
+	Completed  int
+	Failed     int
+	Cancelled  int
+}
+
+// Progress is the percentage of tasks that reached a final status.
+func (c TaskCounts) Progress() float64 {
+	if c.Total == 0 {
+		return 0
+	}
+	return float64(c.Completed+c.Failed+c.Cancelled) * 100 / float64(c.Total)
+}
+
+// JobPriority is the lane a job's tasks are queued in, so small interactive
+// conversions do not wait behind large imports.
+type JobPriority string
+
+const (
+	JobPriorityInteractive JobPriority = "interactive"
+	JobPriorityNormal      JobPriority = "normal"
+	JobPriorityBulk        JobPriority = "bulk"
+)
+
+// JobPriorities lists the priorities from most to least urgent.
+func JobPriorities() []JobPriority {
+	return []JobPriority{JobPriorityInteractive, JobPriorityNormal, JobPriorityBulk}
+}
+
 type Job struct {
-	ID        string
-	Tasks     []Task
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID          string
+	OwnerID     string
+	Status      JobStatus
+	Priority    JobPriority
+	TaskCounts  TaskCounts
+	Tasks       []Task
+	CallbackURL string
+	// StartedAt is when the first task started, FinishedAt when the last
+	// one finished; both are zero until then.
+	StartedAt  time.Time
+	FinishedAt time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
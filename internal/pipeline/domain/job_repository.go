@@ -1,9 +1,33 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
+// JobFilter narrows and orders a job listing. Zero values disable a filter.
+type JobFilter struct {
+	Status        JobStatus
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// FileName matches jobs with an input file whose name contains it
+	FileName    string
+	OldestFirst bool
+	Cursor      string
+	Limit       int
+}
+
+// JobPage is one page of a job listing. NextCursor is empty on the last page.
+type JobPage struct {
+	Jobs       []Job
+	NextCursor string
+}
+
+// JobRepository reads jobs on behalf of their owner; jobs of other owners
+// are reported as not found.
 type JobRepository interface {
-	GetJobByID(ctx context.Context, jobID string) (*Job, error)
-	GetJobWithTasksAndFiles(ctx context.Context, jobID string) (*Job, error)
+	GetJobByID(ctx context.Context, ownerID, jobID string) (*Job, error)
+	GetJobWithTasksAndFiles(ctx context.Context, ownerID, jobID string) (*Job, error)
+	ListJobs(ctx context.Context, ownerID string, filter *JobFilter) (*JobPage, error)
 	CreateJob(ctx context.Context, job *Job) (*Job, error)
 }
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"errors"
 	"slices"
 	"time"
 
@@ -14,47 +15,157 @@ const (
 	StatusProcessing TaskStatus = "processing"
 	StatusCompleted  TaskStatus = "completed"
 	StatusFailed     TaskStatus = "failed"
+	StatusCancelled  TaskStatus = "cancelled"
 )
 
+// ErrTaskCancelled is returned when updating a task that was cancelled in
+// the meantime, or taken over by another worker after this one's lease
+// expired; a cancellation is never overwritten.
+var ErrTaskCancelled = errors.New("task was cancelled")
+
+var (
+	// ErrTaskBusy is returned when claiming a task whose lease another
+	// worker still holds.
+	ErrTaskBusy = errors.New("task is being processed by another worker")
+	// ErrTaskFinished is returned when claiming a task that already reached
+	// a final status.
+	ErrTaskFinished = errors.New("task already finished")
+)
+
+// IsFinal reports whether no further transitions are expected.
+func (s TaskStatus) IsFinal() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
 type Task struct {
 	ID                string
+	JobID             string
 	File              File
+	Inputs            []File
 	TargetFormat      string
+	Options           ConversionOptions
 	ConvertedFileName string
 	Status            TaskStatus
+	ErrorMessage      string
+	Attempts          int
+	WorkerID          string
+	StartedAt         time.Time
+	CompletedAt       time.Time
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
 
-var AllowedConversions = map[string][]string{
-	// source -> dest
-	"pdf":  {"pdf", "docx", "epub"},
-	"docx": {"pdf", "docx", "epub"},
-	"epub": {"pdf", "docx", "epub"},
+// TaskAttempt records one run of a task by a worker. Task.Attempts counts
+// them and Task.WorkerID names the worker of the current one.
+type TaskAttempt struct {
+	Attempt      int
+	WorkerID     string
+	Status       TaskStatus
+	ErrorMessage string
+	StartedAt    time.Time
+	CompletedAt  time.Time
+}
 
-	"png":  {"png", "webp", "jpeg", "svg", "pdf"},
-	"jpeg": {"png", "webp", "jpeg", "svg", "pdf"},
-	"webp": {"png", "webp", "jpeg", "svg", "pdf"},
-	"svg":  {"png", "webp", "jpeg", "svg", "pdf"},
+// TaskMessage is the payload queued for workers for every task that needs
+// to be converted.
+type TaskMessage struct {
+	TaskID string `json:"task_id"`
 }
 
-func NewTask(file File, targetFormat string) (*Task, error) {
-	allowed, ok := AllowedConversions[file.OriginalFormat]
+func NewTask(file File, targetFormat string, options ConversionOptions) (*Task, error) {
+	converter, ok := LookupConverter(file.OriginalFormat, targetFormat)
 	if !ok {
-		return nil, apperror.BadRequest("unsupported source format: "+file.OriginalFormat, "", nil)
+		return nil, apperror.BadRequest("conversion from "+file.OriginalFormat+" to "+targetFormat+" is not supported", "", nil)
 	}
 
-	valid := slices.Contains(allowed, targetFormat)
-	if !valid {
-		return nil, apperror.BadRequest("conversion from "+file.OriginalFormat+" to "+targetFormat+" is not allowed", "", nil)
+	if v, ok := converter.(OptionsValidator); ok {
+		if err := v.ValidateOptions(options); err != nil {
+			return nil, apperror.BadRequest(err.Error(), "", nil)
+		}
 	}
 
 	now := time.Now()
 	return &Task{
 		File:         file,
 		TargetFormat: targetFormat,
+		Options:      options,
+		Status:       StatusPending,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}, nil
+}
+
+// NewMergedTask creates a task that combines files, in order, into a single
+// output of targetFormat.
+func NewMergedTask(files []File, targetFormat string, options ConversionOptions) (*Task, error) {
+	if len(files) == 0 {
+		return nil, apperror.BadRequest("merge requires at least one file", "", nil)
+	}
+
+	merger, ok := LookupMerger(targetFormat)
+	if !ok {
+		return nil, apperror.BadRequest("merging into "+targetFormat+" is not supported", "", nil)
+	}
+
+	for _, file := range files {
+		if !slices.Contains(merger.SourceFormats(), file.OriginalFormat) {
+			return nil, apperror.BadRequest("merging "+file.OriginalFormat+" into "+targetFormat+" is not supported", "", nil)
+		}
+	}
+
+	if v, ok := merger.(OptionsValidator); ok {
+		if err := v.ValidateOptions(options); err != nil {
+			return nil, apperror.BadRequest(err.Error(), "", nil)
+		}
+	}
+
+	now := time.Now()
+	return &Task{
+		File:         files[0],
+		Inputs:       files,
+		TargetFormat: targetFormat,
+		Options:      options,
 		Status:       StatusPending,
 		CreatedAt:    now,
 		UpdatedAt:    now,
 	}, nil
 }
+
+// IsMerge reports whether the task combines several input files.
+func (t *Task) IsMerge() bool {
+	return len(t.Inputs) > 0
+}
+
+// Class is the class of the converter or merger the task runs, which
+// decides the worker pool it is queued for.
+func (t *Task) Class() string {
+	var impl any
+	if t.IsMerge() {
+		impl, _ = LookupMerger(t.TargetFormat)
+	} else {
+		impl, _ = LookupConverter(t.File.OriginalFormat, t.TargetFormat)
+	}
+	return ConverterClass(impl)
+}
+
+// Sources returns the files the task reads, in order.
+func (t *Task) Sources() []File {
+	if t.IsMerge() {
+		return t.Inputs
+	}
+	return []File{t.File}
+}
+
+// Complete marks the task as successfully converted into convertedFileName.
+func (t *Task) Complete(convertedFileName string) {
+	t.Status = StatusCompleted
+	t.ConvertedFileName = convertedFileName
+	t.CompletedAt = time.Now()
+}
+
+// Fail marks the task as failed with the given reason.
+func (t *Task) Fail(reason string) {
+	t.Status = StatusFailed
+	t.ErrorMessage = reason
+	t.CompletedAt = time.Now()
+}
@@ -0,0 +1,17 @@
+package domain
+
+import "context"
+
+// TaskCancelSignaler tells workers that a task was cancelled so they stop
+// converting it. Signals are best effort: a worker that misses one still
+// cannot overwrite the cancellation, it only finishes the work for nothing.
+type TaskCancelSignaler interface {
+	SignalTaskCancelled(ctx context.Context, taskID string) error
+}
+
+type TaskCancelWatcher interface {
+	// WatchTaskCancellation returns a context that is done once the task is
+	// cancelled. The returned stop function must be called when the task is
+	// no longer being worked on.
+	WatchTaskCancellation(ctx context.Context, taskID string) (context.Context, context.CancelFunc)
+}
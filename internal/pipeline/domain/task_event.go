@@ -0,0 +1,46 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+// TaskEvent announces a task status transition to progress listeners.
+type TaskEvent struct {
+	JobID             string     `json:"job_id"`
+	TaskID            string     `json:"task_id"`
+	Status            TaskStatus `json:"status"`
+	ConvertedFileName string     `json:"converted_file_name,omitempty"`
+	ErrorMessage      string     `json:"error_message,omitempty"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+func NewTaskEvent(task *Task) TaskEvent {
+	return TaskEvent{
+		JobID:             task.JobID,
+		TaskID:            task.ID,
+		Status:            task.Status,
+		ConvertedFileName: task.ConvertedFileName,
+		ErrorMessage:      task.ErrorMessage,
+		UpdatedAt:         task.UpdatedAt,
+	}
+}
+
+type TaskEventPublisher interface {
+	PublishTaskEvent(ctx context.Context, event TaskEvent) error
+}
+
+// TaskEventSubscription delivers the events of one job until closed.
+type TaskEventSubscription interface {
+	Events() <-chan TaskEvent
+	Close() error
+}
+
+type TaskEventSubscriber interface {
+	SubscribeJobEvents(ctx context.Context, jobID string) (TaskEventSubscription, error)
+}
+
+type TaskEventBus interface {
+	TaskEventPublisher
+	TaskEventSubscriber
+}
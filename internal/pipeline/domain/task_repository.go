@@ -1,7 +1,44 @@
 package domain
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type TaskRepository interface {
-	GetTaskByID(ctx context.Context, taskID string) (*Task, error)
+	// GetTaskByID returns the task if it belongs to a job of ownerID.
+	GetTaskByID(ctx context.Context, ownerID, taskID string) (*Task, error)
+	// GetTaskForProcessing returns the task regardless of its owner. It is
+	// meant for workers, which act on behalf of every owner.
+	GetTaskForProcessing(ctx context.Context, taskID string) (*Task, error)
+	// ClaimTask starts a new attempt of a pending task for workerID, or of
+	// a processing task whose worker has not renewed its lease for lease.
+	// It returns ErrTaskBusy while another worker holds the lease and
+	// ErrTaskFinished if the task reached a final status.
+	ClaimTask(ctx context.Context, taskID, workerID string, lease time.Duration) (*Task, error)
+	// RenewTaskLease keeps the current attempt of a claimed task from being
+	// taken over. It returns ErrTaskCancelled if the task was cancelled or
+	// taken over already.
+	RenewTaskLease(ctx context.Context, task *Task) error
+	// UpdateTaskStatus finishes the current attempt of a claimed task. It
+	// returns ErrTaskCancelled if the task was cancelled or taken over.
+	UpdateTaskStatus(ctx context.Context, task *Task) (*Task, error)
+	// RequeueTask returns a claimed task to pending after a transient
+	// failure, recording reason on its current attempt. It returns
+	// ErrTaskCancelled if the task was cancelled or taken over.
+	RequeueTask(ctx context.Context, task *Task, reason string) (*Task, error)
+	// CancelTask cancels a pending or processing task of ownerID.
+	CancelTask(ctx context.Context, ownerID, taskID string) (*Task, error)
+	// CancelJobTasks cancels the pending and processing tasks of a job of
+	// ownerID and returns them.
+	CancelJobTasks(ctx context.Context, ownerID, jobID string) ([]Task, error)
+	// RetryTask requeues a failed task of ownerID.
+	RetryTask(ctx context.Context, ownerID, taskID string) (*Task, error)
+	// RetryJobFailedTasks requeues the failed tasks of a job of ownerID and
+	// returns them.
+	RetryJobFailedTasks(ctx context.Context, ownerID, jobID string) ([]Task, error)
+	GetTaskAttempts(ctx context.Context, ownerID, taskID string) ([]TaskAttempt, error)
+	// CountPendingTasks returns the pending tasks of every owner by the
+	// priority of their job.
+	CountPendingTasks(ctx context.Context) (map[JobPriority]int, error)
 }
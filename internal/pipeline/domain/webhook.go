@@ -0,0 +1,151 @@
+package domain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+type WebhookEvent string
+
+const (
+	WebhookTaskCompleted      WebhookEvent = "task.completed"
+	WebhookTaskFailed         WebhookEvent = "task.failed"
+	WebhookTaskCancelled      WebhookEvent = "task.cancelled"
+	WebhookJobCompleted       WebhookEvent = "job.completed"
+	WebhookJobFailed          WebhookEvent = "job.failed"
+	WebhookJobPartiallyFailed WebhookEvent = "job.partially_failed"
+	WebhookJobCancelled       WebhookEvent = "job.cancelled"
+)
+
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "pending"
+	WebhookDelivered WebhookStatus = "delivered"
+	WebhookFailed    WebhookStatus = "failed"
+)
+
+// WebhookPayload is the JSON body posted to a job's callback URL. Task
+// events carry the task, job events carry every task of the job.
+type WebhookPayload struct {
+	Event      WebhookEvent `json:"event"`
+	JobID      string       `json:"job_id"`
+	Task       *TaskEvent   `json:"task,omitempty"`
+	Tasks      []TaskEvent  `json:"tasks,omitempty"`
+	OccurredAt time.Time    `json:"occurred_at"`
+}
+
+// WebhookDelivery is one event queued for a job's callback URL together
+// with the attempts made to deliver it.
+type WebhookDelivery struct {
+	ID            string
+	JobID         string
+	TaskID        string
+	Event         WebhookEvent
+	Status        WebhookStatus
+	Attempts      []WebhookAttempt
+	NextAttemptAt time.Time
+	LastError     string
+	DeliveredAt   time.Time
+	CreatedAt     time.Time
+}
+
+type WebhookAttempt struct {
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+type WebhookRepository interface {
+	GetJobWebhookDeliveries(ctx context.Context, jobID string) ([]WebhookDelivery, error)
+	// GetOrCreateWebhookSecret returns the owner's signing secret, storing
+	// secret first if the owner has none.
+	GetOrCreateWebhookSecret(ctx context.Context, ownerID, secret string) (string, error)
+	RotateWebhookSecret(ctx context.Context, ownerID, secret string) (string, error)
+}
+
+func NewTaskWebhook(task *Task) WebhookPayload {
+	event := WebhookTaskCompleted
+	switch task.Status {
+	case StatusFailed:
+		event = WebhookTaskFailed
+	case StatusCancelled:
+		event = WebhookTaskCancelled
+	}
+
+	taskEvent := NewTaskEvent(task)
+	return WebhookPayload{
+		Event:      event,
+		JobID:      task.JobID,
+		Task:       &taskEvent,
+		OccurredAt: time.Now(),
+	}
+}
+
+// NewJobWebhook builds the job event once every task is final. The event
+// follows the job's status: cancelled if all tasks were, and otherwise
+// completed, failed or partially failed by the outcome of the other tasks.
+func NewJobWebhook(jobID string, tasks []Task) (WebhookPayload, bool) {
+	var completed, failed int
+	events := make([]TaskEvent, len(tasks))
+
+	for i := range tasks {
+		if !tasks[i].Status.IsFinal() {
+			return WebhookPayload{}, false
+		}
+		switch tasks[i].Status {
+		case StatusCompleted:
+			completed++
+		case StatusFailed:
+			failed++
+		}
+		events[i] = NewTaskEvent(&tasks[i])
+	}
+
+	var event WebhookEvent
+	switch {
+	case completed+failed == 0:
+		event = WebhookJobCancelled
+	case failed == 0:
+		event = WebhookJobCompleted
+	case completed == 0:
+		event = WebhookJobFailed
+	default:
+		event = WebhookJobPartiallyFailed
+	}
+
+	return WebhookPayload{
+		Event:      event,
+		JobID:      jobID,
+		Tasks:      events,
+		OccurredAt: time.Now(),
+	}, true
+}
+
+// NewWebhookSecret generates a signing secret. Each owner has one, used for
+// the webhooks of all their jobs.
+func NewWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 of "<unix timestamp>.<body>".
+// Receivers recompute it from the X-Swytch-Timestamp header and the raw
+// body, and should reject stale timestamps to prevent replays.
+func SignWebhook(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,45 @@
+package domain
+
+import "testing"
+
+func TestNewJobWebhook(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []TaskStatus
+		want     WebhookEvent
+		done     bool
+	}{
+		{"all completed", []TaskStatus{StatusCompleted, StatusCompleted}, WebhookJobCompleted, true},
+		{"completed and cancelled", []TaskStatus{StatusCompleted, StatusCancelled}, WebhookJobCompleted, true},
+		{"all failed", []TaskStatus{StatusFailed, StatusFailed}, WebhookJobFailed, true},
+		{"failed and cancelled", []TaskStatus{StatusFailed, StatusCancelled}, WebhookJobFailed, true},
+		{"completed and failed", []TaskStatus{StatusCompleted, StatusFailed}, WebhookJobPartiallyFailed, true},
+		{"mixed", []TaskStatus{StatusCancelled, StatusFailed, StatusCompleted}, WebhookJobPartiallyFailed, true},
+		{"all cancelled", []TaskStatus{StatusCancelled, StatusCancelled}, WebhookJobCancelled, true},
+		{"pending task", []TaskStatus{StatusCompleted, StatusPending}, "", false},
+		{"processing task", []TaskStatus{StatusFailed, StatusProcessing}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks := make([]Task, len(tt.statuses))
+			for i, status := range tt.statuses {
+				tasks[i] = Task{JobID: "job", Status: status}
+			}
+
+			payload, done := NewJobWebhook("job", tasks)
+			if done != tt.done {
+				t.Fatalf("done = %v, want %v", done, tt.done)
+			}
+			if !done {
+				return
+			}
+			if payload.Event != tt.want {
+				t.Errorf("event = %s, want %s", payload.Event, tt.want)
+			}
+			if payload.JobID != "job" || len(payload.Tasks) != len(tasks) {
+				t.Errorf("payload = %+v, want job with %d tasks", payload, len(tasks))
+			}
+		})
+	}
+}
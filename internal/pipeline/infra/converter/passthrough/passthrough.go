@@ -0,0 +1,30 @@
+package passthrough
+
+import (
+	"context"
+	"io"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+// Formats that are delivered unchanged when the target matches the source.
+var formats = []string{"pdf", "docx", "epub", "svg"}
+
+func init() {
+	for _, format := range formats {
+		domain.RegisterConverter(&Converter{format: format})
+	}
+}
+
+// Converter copies the source file as is.
+type Converter struct {
+	format string
+}
+
+func (c *Converter) SourceFormat() string { return c.format }
+func (c *Converter) TargetFormat() string { return c.format }
+
+func (c *Converter) Convert(ctx context.Context, in io.Reader, out io.Writer, opts domain.ConversionOptions) error {
+	_, err := io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,317 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"github.com/meraf00/swytch/internal/pipeline/infra/converter/raster"
+	"github.com/meraf00/swytch/internal/pipeline/infra/converter/svg"
+)
+
+// Images are assumed to be 96 DPI, the CSS pixel SVG also uses
+const pointsPerPixel = 72.0 / 96.0
+
+// Portrait page sizes in points
+var pageSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"letter": {612, 792},
+}
+
+var imageFormats = append(raster.SourceFormats(), "svg")
+
+func init() {
+	for _, source := range imageFormats {
+		domain.RegisterConverter(&ImageConverter{source: source})
+	}
+	domain.RegisterMerger(&ImageMerger{})
+}
+
+// ImageConverter wraps a single image into a one page PDF.
+//
+// Options:
+//   - page_size: a4, letter or fit (default), where fit sizes the page to the image
+//   - margin: page margin in points
+//   - orientation: auto (default), portrait or landscape
+//   - width, height, dpi: rasterization size for SVG sources
+type ImageConverter struct {
+	source string
+}
+
+func (c *ImageConverter) SourceFormat() string { return c.source }
+func (c *ImageConverter) TargetFormat() string { return "pdf" }
+func (c *ImageConverter) Class() string        { return "document" }
+
+func (c *ImageConverter) ValidateOptions(opts domain.ConversionOptions) error {
+	return validateImageOptions(opts)
+}
+
+func (c *ImageConverter) Convert(ctx context.Context, in io.Reader, out io.Writer, opts domain.ConversionOptions) error {
+	return writeImages(ctx, []domain.Source{{Format: c.source, Reader: in}}, out, opts)
+}
+
+// ImageMerger assembles several images into one PDF with a page per image.
+// It takes the same options as ImageConverter.
+type ImageMerger struct{}
+
+func (m *ImageMerger) SourceFormats() []string { return slices.Clone(imageFormats) }
+func (m *ImageMerger) TargetFormat() string    { return "pdf" }
+func (m *ImageMerger) Class() string           { return "document" }
+
+func (m *ImageMerger) ValidateOptions(opts domain.ConversionOptions) error {
+	return validateImageOptions(opts)
+}
+
+func (m *ImageMerger) Merge(ctx context.Context, sources []domain.Source, out io.Writer, opts domain.ConversionOptions) error {
+	return writeImages(ctx, sources, out, opts)
+}
+
+func validateImageOptions(opts domain.ConversionOptions) error {
+	if _, err := parseLayout(opts); err != nil {
+		return err
+	}
+	return svg.ValidateSizeOptions(opts)
+}
+
+type layout struct {
+	pageSize    string
+	margin      float64
+	orientation string
+}
+
+func parseLayout(opts domain.ConversionOptions) (layout, error) {
+	l := layout{pageSize: "fit", orientation: "auto"}
+
+	if value, ok := opts["page_size"]; ok {
+		value = strings.ToLower(value)
+		if _, known := pageSizes[value]; !known && value != "fit" {
+			return l, fmt.Errorf("page_size must be one of a4, letter or fit")
+		}
+		l.pageSize = value
+	}
+
+	if value, ok := opts["orientation"]; ok {
+		value = strings.ToLower(value)
+		if value != "auto" && value != "portrait" && value != "landscape" {
+			return l, fmt.Errorf("orientation must be one of auto, portrait or landscape")
+		}
+		l.orientation = value
+	}
+
+	if value, ok := opts["margin"]; ok {
+		margin, err := strconv.ParseFloat(value, 64)
+		if err != nil || margin < 0 {
+			return l, fmt.Errorf("margin must be a non-negative number of points")
+		}
+		if size, fixed := pageSizes[l.pageSize]; fixed && 2*margin >= min(size[0], size[1]) {
+			return l, fmt.Errorf("margin leaves no room on the page")
+		}
+		l.margin = margin
+	}
+
+	return l, nil
+}
+
+type placement struct {
+	pageW, pageH float64
+	x, y, w, h   float64
+}
+
+// place centers an image of the given pixel size on the page, scaling it
+// to fit within the margins.
+func (l layout) place(width, height int) placement {
+	iw := float64(width) * pointsPerPixel
+	ih := float64(height) * pointsPerPixel
+
+	size, fixed := pageSizes[l.pageSize]
+	if !fixed {
+		return placement{
+			pageW: iw + 2*l.margin,
+			pageH: ih + 2*l.margin,
+			x:     l.margin,
+			y:     l.margin,
+			w:     iw,
+			h:     ih,
+		}
+	}
+
+	pageW, pageH := size[0], size[1]
+	if l.orientation == "landscape" || (l.orientation == "auto" && iw > ih) {
+		pageW, pageH = pageH, pageW
+	}
+
+	scale := min((pageW-2*l.margin)/iw, (pageH-2*l.margin)/ih)
+	w, h := iw*scale, ih*scale
+
+	return placement{
+		pageW: pageW,
+		pageH: pageH,
+		x:     (pageW - w) / 2,
+		y:     (pageH - h) / 2,
+		w:     w,
+		h:     h,
+	}
+}
+
+func writeImages(ctx context.Context, sources []domain.Source, out io.Writer, opts domain.ConversionOptions) error {
+	l, err := parseLayout(opts)
+	if err != nil {
+		return err
+	}
+
+	pw := newWriter(out)
+	catalogID := pw.reserve()
+	pagesID := pw.reserve()
+
+	kids := make([]string, 0, len(sources))
+	for _, src := range sources {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		img, err := loadImage(src, opts)
+		if err != nil {
+			return err
+		}
+
+		imageDict := fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter %s",
+			img.width, img.height, img.colorSpace, img.filter,
+		)
+		if img.smask != nil {
+			smaskID := pw.reserve()
+			pw.stream(smaskID, fmt.Sprintf(
+				"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode",
+				img.width, img.height,
+			), img.smask)
+			imageDict += fmt.Sprintf(" /SMask %d 0 R", smaskID)
+		}
+
+		imageID := pw.reserve()
+		pw.stream(imageID, imageDict, img.data)
+
+		p := l.place(img.width, img.height)
+		contentID := pw.reserve()
+		pw.stream(contentID, "", fmt.Appendf(nil, "q %.2f 0 0 %.2f %.2f %.2f cm /Im0 Do Q", p.w, p.h, p.x, p.y))
+
+		pageID := pw.reserve()
+		pw.object(pageID, fmt.Sprintf(
+			"<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pagesID, p.pageW, p.pageH, imageID, contentID,
+		))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageID))
+	}
+
+	pw.object(pagesID, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	pw.object(catalogID, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pagesID))
+
+	return pw.close(catalogID)
+}
+
+type pdfImage struct {
+	width      int
+	height     int
+	colorSpace string
+	filter     string
+	data       []byte
+	smask      []byte
+}
+
+// loadImage prepares a source for embedding. Baseline RGB and grayscale
+// JPEGs are embedded as is; everything else is decoded and recompressed.
+// Sources larger than raster.MaxPixels are rejected before decoding.
+func loadImage(src domain.Source, opts domain.ConversionOptions) (*pdfImage, error) {
+	data, err := io.ReadAll(src.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var img image.Image
+	switch src.Format {
+	case "jpeg":
+		if embedded, ok := embedJPEG(data); ok {
+			return embedded, nil
+		}
+		img, err = raster.Decode(bytes.NewReader(data), src.Format)
+	case "svg":
+		img, err = svg.Rasterize(bytes.NewReader(data), opts)
+	default:
+		img, err = raster.Decode(bytes.NewReader(data), src.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeImage(img)
+}
+
+func embedJPEG(data []byte) (*pdfImage, bool) {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	// Oversized JPEGs are left for raster.Decode to reject
+	if err != nil || raster.CheckSize(cfg.Width, cfg.Height) != nil {
+		return nil, false
+	}
+
+	var colorSpace string
+	switch cfg.ColorModel {
+	case color.YCbCrModel:
+		colorSpace = "/DeviceRGB"
+	case color.GrayModel:
+		colorSpace = "/DeviceGray"
+	default:
+		return nil, false
+	}
+
+	return &pdfImage{
+		width:      cfg.Width,
+		height:     cfg.Height,
+		colorSpace: colorSpace,
+		filter:     "/DCTDecode",
+		data:       data,
+	}, true
+}
+
+func encodeImage(img image.Image) (*pdfImage, error) {
+	b := img.Bounds()
+	nrgba := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	pixels := b.Dx() * b.Dy()
+	rgb := make([]byte, 0, pixels*3)
+	alpha := make([]byte, 0, pixels)
+	for i := 0; i < len(nrgba.Pix); i += 4 {
+		rgb = append(rgb, nrgba.Pix[i], nrgba.Pix[i+1], nrgba.Pix[i+2])
+		alpha = append(alpha, nrgba.Pix[i+3])
+	}
+
+	data, err := deflate(rgb)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := &pdfImage{
+		width:      b.Dx(),
+		height:     b.Dy(),
+		colorSpace: "/DeviceRGB",
+		filter:     "/FlateDecode",
+		data:       data,
+	}
+
+	if !nrgba.Opaque() {
+		encoded.smask, err = deflate(alpha)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return encoded, nil
+}
@@ -0,0 +1,234 @@
+package pdf
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"github.com/meraf00/swytch/internal/pipeline/infra/converter/raster"
+)
+
+const (
+	// pdftoppm from poppler-utils does the actual rendering. It has to be on
+	// PATH, otherwise PDF to image conversions are not offered at all.
+	rendererBinary = "pdftoppm"
+
+	defaultRenderDPI = 150
+	minRenderDPI     = 18
+	maxRenderDPI     = 600
+
+	maxRenderedPages = 200
+)
+
+func init() {
+	if _, err := exec.LookPath(rendererBinary); err != nil {
+		return
+	}
+	for _, target := range raster.Formats() {
+		domain.RegisterConverter(&PageRenderer{target: target})
+	}
+}
+
+// PageRenderer renders PDF pages to images. A single page produces an
+// image in the target format; several pages produce a zip with one image
+// per page named page-<n>.<format>.
+//
+// Options:
+//   - pages: comma separated pages and ranges such as 1-3,7 (default 1)
+//   - dpi: render resolution from 18 to 600 (default 150)
+//   - background, quality: as for raster targets
+type PageRenderer struct {
+	target string
+}
+
+func (r *PageRenderer) SourceFormat() string { return "pdf" }
+func (r *PageRenderer) TargetFormat() string { return r.target }
+func (r *PageRenderer) Class() string        { return "document" }
+
+func (r *PageRenderer) ValidateOptions(opts domain.ConversionOptions) error {
+	if _, err := parsePages(opts); err != nil {
+		return err
+	}
+	if _, err := renderDPI(opts); err != nil {
+		return err
+	}
+	if _, err := raster.Quality(opts); err != nil {
+		return err
+	}
+	_, err := raster.Background(opts)
+	return err
+}
+
+func (r *PageRenderer) OutputFormat(opts domain.ConversionOptions) string {
+	if pages, err := parsePages(opts); err == nil && len(pages) > 1 {
+		return "zip"
+	}
+	return r.target
+}
+
+func (r *PageRenderer) Convert(ctx context.Context, in io.Reader, out io.Writer, opts domain.ConversionOptions) error {
+	pages, err := parsePages(opts)
+	if err != nil {
+		return err
+	}
+	dpi, err := renderDPI(opts)
+	if err != nil {
+		return err
+	}
+
+	workDir, err := os.MkdirTemp("", "swytch-pdf-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+
+	srcPath := filepath.Join(workDir, "source.pdf")
+	if err := writeFile(srcPath, in); err != nil {
+		return err
+	}
+
+	if len(pages) == 1 {
+		img, err := renderPage(ctx, srcPath, workDir, pages[0], dpi)
+		if err != nil {
+			return err
+		}
+		return raster.Encode(out, img, r.target, opts)
+	}
+
+	archive := zip.NewWriter(out)
+	for _, page := range pages {
+		img, err := renderPage(ctx, srcPath, workDir, page, dpi)
+		if err != nil {
+			return err
+		}
+
+		entry, err := archive.Create(fmt.Sprintf("page-%d.%s", page, r.target))
+		if err != nil {
+			return err
+		}
+		if err := raster.Encode(entry, img, r.target, opts); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// renderPage rasterizes a single page to PNG and decodes it, so that every
+// target goes through the same encoders and options.
+func renderPage(ctx context.Context, srcPath, workDir string, page, dpi int) (image.Image, error) {
+	prefix := filepath.Join(workDir, "page-"+strconv.Itoa(page))
+	n := strconv.Itoa(page)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, rendererBinary,
+		"-png", "-singlefile",
+		"-r", strconv.Itoa(dpi),
+		"-f", n, "-l", n,
+		srcPath, prefix,
+	)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("failed to render page %d: %s", page, msg)
+		}
+		return nil, fmt.Errorf("failed to render page %d: %w", page, err)
+	}
+
+	f, err := os.Open(prefix + ".png")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("page %d is out of range", page)
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	return raster.Decode(f, "png")
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parsePages reads the "pages" option, keeping the requested order and
+// dropping repeated pages.
+func parsePages(opts domain.ConversionOptions) ([]int, error) {
+	value, ok := opts["pages"]
+	if !ok {
+		return []int{1}, nil
+	}
+
+	var pages []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(strings.TrimSpace(first))
+		if err != nil || from < 1 {
+			return nil, fmt.Errorf("pages must list page numbers or ranges such as 1-3,7")
+		}
+
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(strings.TrimSpace(last))
+			if err != nil || to < from {
+				return nil, fmt.Errorf("pages must list page numbers or ranges such as 1-3,7")
+			}
+		}
+
+		if to-from >= maxRenderedPages {
+			return nil, fmt.Errorf("at most %d pages can be rendered at once", maxRenderedPages)
+		}
+
+		for page := from; page <= to; page++ {
+			if seen[page] {
+				continue
+			}
+			seen[page] = true
+			pages = append(pages, page)
+		}
+
+		if len(pages) > maxRenderedPages {
+			return nil, fmt.Errorf("at most %d pages can be rendered at once", maxRenderedPages)
+		}
+	}
+
+	return pages, nil
+}
+
+func renderDPI(opts domain.ConversionOptions) (int, error) {
+	value, ok := opts["dpi"]
+	if !ok {
+		return defaultRenderDPI, nil
+	}
+
+	dpi, err := strconv.Atoi(value)
+	if err != nil || dpi < minRenderDPI || dpi > maxRenderDPI {
+		return 0, fmt.Errorf("dpi must be an integer between %d and %d", minRenderDPI, maxRenderDPI)
+	}
+	return dpi, nil
+}
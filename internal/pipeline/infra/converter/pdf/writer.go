@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// writer emits a minimal PDF 1.4 document. Object numbers are reserved up
+// front so objects can reference each other before they are written.
+type writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets []int64
+	err     error
+}
+
+func newWriter(w io.Writer) *writer {
+	pw := &writer{w: bufio.NewWriter(w)}
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	return pw
+}
+
+func (pw *writer) printf(format string, args ...any) {
+	if pw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(pw.w, format, args...)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *writer) write(data []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(data)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+// reserve returns the next free object number.
+func (pw *writer) reserve() int {
+	pw.offsets = append(pw.offsets, -1)
+	return len(pw.offsets)
+}
+
+func (pw *writer) object(id int, body string) {
+	pw.offsets[id-1] = pw.n
+	pw.printf("%d 0 obj\n%s\nendobj\n", id, body)
+}
+
+func (pw *writer) stream(id int, dict string, data []byte) {
+	if dict != "" {
+		dict += " "
+	}
+	pw.offsets[id-1] = pw.n
+	pw.printf("%d 0 obj\n<< %s/Length %d >>\nstream\n", id, dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// close writes the cross-reference table and trailer.
+func (pw *writer) close(rootID int) error {
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1)
+	for id, offset := range pw.offsets {
+		if offset < 0 {
+			return fmt.Errorf("pdf object %d was reserved but never written", id+1)
+		}
+		pw.printf("%010d 00000 n \n", offset)
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, rootID, xref)
+
+	if pw.err != nil {
+		return pw.err
+	}
+	return pw.w.Flush()
+}
+
+func deflate(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,304 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(pw *writer) int
+		objects int
+		wantErr bool
+	}{
+		{
+			name: "single object",
+			build: func(pw *writer) int {
+				id := pw.reserve()
+				pw.object(id, "<< /Type /Catalog >>")
+				return id
+			},
+			objects: 1,
+		},
+		{
+			name: "forward references",
+			build: func(pw *writer) int {
+				catalog := pw.reserve()
+				pages := pw.reserve()
+				content := pw.reserve()
+				pw.stream(content, "", []byte("q Q"))
+				pw.object(pages, "<< /Type /Pages /Kids [] /Count 0 >>")
+				pw.object(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+				return catalog
+			},
+			objects: 3,
+		},
+		{
+			name: "stream with dictionary",
+			build: func(pw *writer) int {
+				catalog := pw.reserve()
+				data := pw.reserve()
+				pw.stream(data, "/Filter /FlateDecode", []byte{0, 1, 2, '\n', 'e'})
+				pw.object(catalog, "<< /Type /Catalog >>")
+				return catalog
+			},
+			objects: 2,
+		},
+		{
+			name: "reserved but never written",
+			build: func(pw *writer) int {
+				catalog := pw.reserve()
+				pw.reserve()
+				pw.object(catalog, "<< /Type /Catalog >>")
+				return catalog
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			pw := newWriter(&buf)
+			root := tt.build(pw)
+
+			err := pw.close(root)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("close: %v", err)
+			}
+
+			checkDocument(t, buf.Bytes(), tt.objects, root)
+		})
+	}
+}
+
+func TestStreamLength(t *testing.T) {
+	var buf bytes.Buffer
+	pw := newWriter(&buf)
+	id := pw.reserve()
+	data := []byte("endstream inside the data\n")
+	pw.stream(id, "", data)
+	if err := pw.close(id); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	m := regexp.MustCompile(`/Length (\d+) >>\nstream\n`).FindSubmatchIndex(buf.Bytes())
+	if m == nil {
+		t.Fatal("stream dictionary not found")
+	}
+	length, _ := strconv.Atoi(string(buf.Bytes()[m[2]:m[3]]))
+	got := buf.Bytes()[m[1] : m[1]+length]
+	if !bytes.Equal(got, data) {
+		t.Fatalf("stream = %q, want %q", got, data)
+	}
+	if !bytes.HasPrefix(buf.Bytes()[m[1]+length:], []byte("\nendstream")) {
+		t.Fatal("endstream does not follow the data")
+	}
+}
+
+func TestWriteImages(t *testing.T) {
+	tests := []struct {
+		name      string
+		sources   func() []domain.Source
+		opts      domain.ConversionOptions
+		pages     int
+		mediaBox  string
+		smasks    int
+		dctImages int
+	}{
+		{
+			name:     "png fits the page",
+			sources:  func() []domain.Source { return []domain.Source{pngSource(96, 48, 255)} },
+			pages:    1,
+			mediaBox: "[0 0 72.00 36.00]",
+		},
+		{
+			name:     "margin grows a fitted page",
+			sources:  func() []domain.Source { return []domain.Source{pngSource(96, 96, 255)} },
+			opts:     domain.ConversionOptions{"margin": "10"},
+			pages:    1,
+			mediaBox: "[0 0 92.00 92.00]",
+		},
+		{
+			name:     "wide image turns a4 to landscape",
+			sources:  func() []domain.Source { return []domain.Source{pngSource(200, 100, 255)} },
+			opts:     domain.ConversionOptions{"page_size": "a4"},
+			pages:    1,
+			mediaBox: "[0 0 841.89 595.28]",
+		},
+		{
+			name:     "forced portrait letter",
+			sources:  func() []domain.Source { return []domain.Source{pngSource(200, 100, 255)} },
+			opts:     domain.ConversionOptions{"page_size": "letter", "orientation": "portrait"},
+			pages:    1,
+			mediaBox: "[0 0 612.00 792.00]",
+		},
+		{
+			name:     "transparency adds a soft mask",
+			sources:  func() []domain.Source { return []domain.Source{pngSource(4, 4, 128)} },
+			pages:    1,
+			mediaBox: "[0 0 3.00 3.00]",
+			smasks:   1,
+		},
+		{
+			name:      "jpeg is embedded as is",
+			sources:   func() []domain.Source { return []domain.Source{jpegSource(8, 8)} },
+			pages:     1,
+			mediaBox:  "[0 0 6.00 6.00]",
+			dctImages: 1,
+		},
+		{
+			name: "merge puts each image on a page",
+			sources: func() []domain.Source {
+				return []domain.Source{pngSource(8, 8, 255), jpegSource(8, 8), pngSource(8, 8, 0)}
+			},
+			pages:     3,
+			mediaBox:  "[0 0 6.00 6.00]",
+			smasks:    1,
+			dctImages: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeImages(context.Background(), tt.sources(), &buf, tt.opts); err != nil {
+				t.Fatalf("writeImages: %v", err)
+			}
+			doc := buf.String()
+
+			checkDocument(t, buf.Bytes(), -1, 1)
+
+			if got := strings.Count(doc, "/Type /Page "); got != tt.pages {
+				t.Errorf("pages = %d, want %d", got, tt.pages)
+			}
+			if !strings.Contains(doc, "/Count "+strconv.Itoa(tt.pages)+" >>") {
+				t.Errorf("page tree does not count %d pages", tt.pages)
+			}
+			if !strings.Contains(doc, "/MediaBox "+tt.mediaBox) {
+				t.Errorf("no page with MediaBox %s", tt.mediaBox)
+			}
+			if got := strings.Count(doc, "/SMask "); got != tt.smasks {
+				t.Errorf("soft masks = %d, want %d", got, tt.smasks)
+			}
+			if got := strings.Count(doc, "/DCTDecode"); got != tt.dctImages {
+				t.Errorf("DCT images = %d, want %d", got, tt.dctImages)
+			}
+		})
+	}
+}
+
+func TestEncodeImagePixels(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{R: 1, G: 2, B: 3, A: 255})
+	img.SetNRGBA(1, 0, color.NRGBA{R: 4, G: 5, B: 6, A: 7})
+
+	encoded, err := encodeImage(img)
+	if err != nil {
+		t.Fatalf("encodeImage: %v", err)
+	}
+
+	if got := inflate(t, encoded.data); !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("rgb = %v", got)
+	}
+	if got := inflate(t, encoded.smask); !bytes.Equal(got, []byte{255, 7}) {
+		t.Errorf("alpha = %v", got)
+	}
+}
+
+// checkDocument verifies the cross-reference table points at every object
+// and the trailer at the table. objects < 0 skips the object count.
+func checkDocument(t *testing.T, doc []byte, objects, root int) {
+	t.Helper()
+
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) {
+		t.Fatal("missing header")
+	}
+	if !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatal("missing EOF marker")
+	}
+
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(doc)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(doc[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	var size int
+	if _, err := fmt.Sscanf(string(doc[xref:]), "xref\n0 %d\n", &size); err != nil {
+		t.Fatalf("xref header: %v", err)
+	}
+	if objects >= 0 && size != objects+1 {
+		t.Fatalf("xref size = %d, want %d", size, objects+1)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(doc[xref:], -1)
+	if len(entries) != size-1 {
+		t.Fatalf("xref has %d entries, want %d", len(entries), size-1)
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %q", i+1, doc[offset:min(offset+len(want), len(doc))])
+		}
+	}
+
+	trailer := fmt.Sprintf("<< /Size %d /Root %d 0 R >>", size, root)
+	if !bytes.Contains(doc, []byte(trailer)) {
+		t.Fatalf("trailer %q not found", trailer)
+	}
+}
+
+func pngSource(w, h int, alpha uint8) domain.Source {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+3] = 200, alpha
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return domain.Source{Format: "png", Reader: &buf}
+}
+
+func jpegSource(w, h int) domain.Source {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil)
+	return domain.Source{Format: "jpeg", Reader: &buf}
+}
+
+func inflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("zlib: %v", err)
+	}
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("zlib: %v", err)
+	}
+	return out
+}
@@ -0,0 +1,231 @@
+package raster
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+const (
+	defaultJPEGQuality = 90
+
+	// MaxPixels bounds decoded images, whose RGBA copies take 4 bytes a
+	// pixel, to 256 MiB each
+	MaxPixels = 64 << 20
+)
+
+type decodeFunc func(io.Reader) (image.Image, error)
+
+type decodeConfigFunc func(io.Reader) (image.Config, error)
+
+type encodeFunc func(io.Writer, image.Image, domain.ConversionOptions) error
+
+var decoders = map[string]decodeFunc{
+	"png":  png.Decode,
+	"jpeg": jpeg.Decode,
+	"gif":  gif.Decode,
+	"webp": webp.Decode,
+	"bmp":  bmp.Decode,
+	"tiff": tiff.Decode,
+}
+
+var configDecoders = map[string]decodeConfigFunc{
+	"png":  png.DecodeConfig,
+	"jpeg": jpeg.DecodeConfig,
+	"gif":  gif.DecodeConfig,
+	"webp": webp.DecodeConfig,
+	"bmp":  bmp.DecodeConfig,
+	"tiff": tiff.DecodeConfig,
+}
+
+var encoders = map[string]encodeFunc{
+	"png": func(w io.Writer, img image.Image, _ domain.ConversionOptions) error {
+		return png.Encode(w, img)
+	},
+	"jpeg": func(w io.Writer, img image.Image, opts domain.ConversionOptions) error {
+		quality, err := Quality(opts)
+		if err != nil {
+			return err
+		}
+		bg, err := Background(opts)
+		if err != nil {
+			return err
+		}
+		return jpeg.Encode(w, Flatten(img, bg), &jpeg.Options{Quality: quality})
+	},
+	"gif": func(w io.Writer, img image.Image, opts domain.ConversionOptions) error {
+		bg, err := Background(opts)
+		if err != nil {
+			return err
+		}
+		return gif.Encode(w, Flatten(img, bg), &gif.Options{NumColors: 256})
+	},
+	"webp": func(w io.Writer, img image.Image, _ domain.ConversionOptions) error {
+		return encodeWebP(w, img)
+	},
+	"bmp": func(w io.Writer, img image.Image, _ domain.ConversionOptions) error {
+		return bmp.Encode(w, img)
+	},
+	"tiff": func(w io.Writer, img image.Image, _ domain.ConversionOptions) error {
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate, Predictor: true})
+	},
+}
+
+func init() {
+	for source := range decoders {
+		for target := range encoders {
+			domain.RegisterConverter(&Converter{source: source, target: target})
+		}
+	}
+}
+
+// Converter decodes one raster format and re-encodes it as another.
+//
+// Options:
+//   - quality: JPEG quality from 1 to 100
+//   - background: hex color used where the target has no alpha channel
+type Converter struct {
+	source string
+	target string
+}
+
+func (c *Converter) SourceFormat() string { return c.source }
+func (c *Converter) TargetFormat() string { return c.target }
+func (c *Converter) Class() string        { return "image" }
+
+func (c *Converter) ValidateOptions(opts domain.ConversionOptions) error {
+	if _, err := Quality(opts); err != nil {
+		return err
+	}
+	_, err := Background(opts)
+	return err
+}
+
+func (c *Converter) Convert(ctx context.Context, in io.Reader, out io.Writer, opts domain.ConversionOptions) error {
+	img, err := Decode(in, c.source)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return Encode(out, img, c.target, opts)
+}
+
+// SourceFormats lists the raster formats this package can decode.
+func SourceFormats() []string {
+	return slices.Sorted(maps.Keys(decoders))
+}
+
+// Formats lists the raster formats this package can encode.
+func Formats() []string {
+	return slices.Sorted(maps.Keys(encoders))
+}
+
+// Decode reads an image in the given raster format. Images larger than
+// MaxPixels are rejected from their header, before any pixels are read.
+func Decode(r io.Reader, format string) (image.Image, error) {
+	decode, ok := decoders[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported raster format: %s", format)
+	}
+
+	// The header read for the size is replayed to the decoder
+	var header bytes.Buffer
+	cfg, err := configDecoders[format](io.TeeReader(r, &header))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	if err := CheckSize(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+
+	img, err := decode(io.MultiReader(&header, r))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	return img, nil
+}
+
+// CheckSize rejects images of more than MaxPixels.
+func CheckSize(width, height int) error {
+	if int64(width)*int64(height) > MaxPixels {
+		return fmt.Errorf("image size %dx%d exceeds %d megapixels", width, height, MaxPixels>>20)
+	}
+	return nil
+}
+
+// Encode writes img in the given raster format.
+func Encode(w io.Writer, img image.Image, format string, opts domain.ConversionOptions) error {
+	encode, ok := encoders[format]
+	if !ok {
+		return fmt.Errorf("unsupported raster format: %s", format)
+	}
+
+	if err := encode(w, img, opts); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", format, err)
+	}
+	return nil
+}
+
+// Quality reads the "quality" option, defaulting to 90.
+func Quality(opts domain.ConversionOptions) (int, error) {
+	value, ok := opts["quality"]
+	if !ok {
+		return defaultJPEGQuality, nil
+	}
+
+	quality, err := strconv.Atoi(value)
+	if err != nil || quality < 1 || quality > 100 {
+		return 0, fmt.Errorf("quality must be an integer between 1 and 100")
+	}
+	return quality, nil
+}
+
+// Background reads the "background" option as #rgb or #rrggbb, defaulting
+// to white.
+func Background(opts domain.ConversionOptions) (color.Color, error) {
+	value, ok := opts["background"]
+	if !ok {
+		return color.White, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || len(hex) != 6 {
+		return nil, fmt.Errorf("background must be a hex color such as #ffffff")
+	}
+
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}, nil
+}
+
+// Flatten composites img over a solid background for formats without alpha.
+func Flatten(img image.Image, bg color.Color) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(b)
+	draw.Draw(dst, b, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, b, img, b.Min, draw.Over)
+	return dst
+}
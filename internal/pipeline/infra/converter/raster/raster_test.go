@@ -0,0 +1,105 @@
+package raster
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRejectsOversizedImages(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   []byte
+	}{
+		{"png", "png", pngHeader(20000, 20000)},
+		{"gif", "gif", gifHeader(65535, 65535)},
+		{"bmp", "bmp", bmpHeader(10000, 10000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(bytes.NewReader(tt.data), tt.format)
+			if err == nil || !strings.Contains(err.Error(), "megapixels") {
+				t.Fatalf("Decode error = %v, want size rejection", err)
+			}
+		})
+	}
+}
+
+func TestDecodeReplaysHeader(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, filled(3, 2, color.NRGBA{R: 1, G: 2, B: 3, A: 255})); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(&buf, "png")
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 3, 2) {
+		t.Fatalf("bounds = %v, want 3x2", got)
+	}
+}
+
+func TestCheckSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ok            bool
+	}{
+		{1, 1, true},
+		{8192, 8192, true},
+		{MaxPixels, 1, true},
+		{MaxPixels + 1, 1, false},
+		{1 << 20, 1 << 20, false},
+	}
+
+	for _, tt := range tests {
+		if err := CheckSize(tt.width, tt.height); (err == nil) != tt.ok {
+			t.Errorf("CheckSize(%d, %d) = %v, want ok %v", tt.width, tt.height, err, tt.ok)
+		}
+	}
+}
+
+// pngHeader returns a PNG signature and IHDR chunk declaring an RGBA image
+// of the given size, with no pixel data.
+func pngHeader(width, height uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+// gifHeader returns a GIF logical screen descriptor of the given size.
+func gifHeader(width, height uint16) []byte {
+	data := []byte("GIF89a")
+	data = binary.LittleEndian.AppendUint16(data, width)
+	data = binary.LittleEndian.AppendUint16(data, height)
+	return append(data, 0, 0, 0)
+}
+
+// bmpHeader returns the file and info headers of a 24-bit BMP of the given
+// size.
+func bmpHeader(width, height int32) []byte {
+	data := []byte("BM")
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, 0)
+	data = binary.LittleEndian.AppendUint32(data, 14+40)
+
+	data = binary.LittleEndian.AppendUint32(data, 40)
+	data = binary.LittleEndian.AppendUint32(data, uint32(width))
+	data = binary.LittleEndian.AppendUint32(data, uint32(height))
+	data = binary.LittleEndian.AppendUint16(data, 1)
+	data = binary.LittleEndian.AppendUint16(data, 24)
+	return append(data, make([]byte, 24)...)
+}
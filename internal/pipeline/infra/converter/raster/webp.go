@@ -0,0 +1,349 @@
+package raster
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+// encodeWebP writes img as a lossless (VP8L) WebP. Pixels are stored as
+// literals with the subtract-green transform and one set of Huffman codes
+// for the whole image, which keeps the encoder small while staying well
+// below the size of an uncompressed bitmap.
+func encodeWebP(w io.Writer, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return errors.New("webp: image dimensions out of range")
+	}
+
+	nrgba := image.NewNRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(nrgba, nrgba.Bounds(), img, b.Min, draw.Src)
+
+	bw := &bitWriter{}
+
+	// Header: signature, size, alpha hint and version
+	bw.writeBits(vp8lSignature, 8)
+	bw.writeBits(uint32(width-1), 14)
+	bw.writeBits(uint32(height-1), 14)
+	bw.writeBits(boolBit(!nrgba.Opaque()), 1)
+	bw.writeBits(0, 3)
+
+	// Transforms: subtract green only
+	bw.writeBits(1, 1)
+	bw.writeBits(transformSubtractGreen, 2)
+	bw.writeBits(0, 1)
+
+	// No color cache, no meta prefix codes
+	bw.writeBits(0, 1)
+	bw.writeBits(0, 1)
+
+	var (
+		green = make([]uint32, 256+24)
+		red   = make([]uint32, 256)
+		blue  = make([]uint32, 256)
+		alpha = make([]uint32, 256)
+	)
+
+	pixels := nrgba.Pix
+	for i := 0; i < len(pixels); i += 4 {
+		r, g, b, a := pixels[i], pixels[i+1], pixels[i+2], pixels[i+3]
+		green[g]++
+		red[r-g]++
+		blue[b-g]++
+		alpha[a]++
+	}
+
+	codes := []*huffmanCode{
+		newHuffmanCode(green, 15),
+		newHuffmanCode(red, 15),
+		newHuffmanCode(blue, 15),
+		newHuffmanCode(alpha, 15),
+		newHuffmanCode(make([]uint32, 40), 15),
+	}
+	for _, c := range codes {
+		c.writeTo(bw)
+	}
+
+	for i := 0; i < len(pixels); i += 4 {
+		r, g, b, a := pixels[i], pixels[i+1], pixels[i+2], pixels[i+3]
+		codes[0].writeSymbol(bw, int(g))
+		codes[1].writeSymbol(bw, int(r-g))
+		codes[2].writeSymbol(bw, int(b-g))
+		codes[3].writeSymbol(bw, int(a))
+	}
+
+	data := bw.bytes()
+	padding := len(data) & 1
+
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+len(data)+padding))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(data)))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+
+	return nil
+}
+
+const (
+	vp8lSignature          = 0x2f
+	vp8lMaxDimension       = 1 << 14
+	transformSubtractGreen = 2
+)
+
+// Order in which code length code lengths are stored.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+type bitWriter struct {
+	buf   []byte
+	bits  uint64
+	nbits uint
+}
+
+// writeBits appends the n low bits of v, least significant bit first.
+func (bw *bitWriter) writeBits(v uint32, n uint) {
+	bw.bits |= uint64(v) << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits >>= 8
+		bw.nbits -= 8
+	}
+}
+
+func (bw *bitWriter) bytes() []byte {
+	if bw.nbits > 0 {
+		bw.buf = append(bw.buf, byte(bw.bits))
+		bw.bits, bw.nbits = 0, 0
+	}
+	return bw.buf
+}
+
+type huffmanCode struct {
+	lengths []uint8
+	codes   []uint16
+	used    []int
+}
+
+func newHuffmanCode(freqs []uint32, maxLength int) *huffmanCode {
+	var used []int
+	for symbol, f := range freqs {
+		if f > 0 {
+			used = append(used, symbol)
+		}
+	}
+
+	// Decoders reject empty codes, so unused alphabets get a single symbol
+	if len(used) == 0 {
+		freqs = append([]uint32(nil), freqs...)
+		freqs[0] = 1
+		used = []int{0}
+	}
+
+	lengths := huffmanLengths(freqs, maxLength)
+	return &huffmanCode{
+		lengths: lengths,
+		codes:   canonicalCodes(lengths),
+		used:    used,
+	}
+}
+
+// isSimple reports whether the code fits the compact "simple code" form of
+// at most two symbols below 256.
+func (h *huffmanCode) isSimple() bool {
+	return len(h.used) <= 2 && h.used[len(h.used)-1] < 256
+}
+
+func (h *huffmanCode) writeTo(bw *bitWriter) {
+	if h.isSimple() {
+		bw.writeBits(1, 1)
+		bw.writeBits(uint32(len(h.used)-1), 1)
+		if first := h.used[0]; first < 2 {
+			bw.writeBits(0, 1)
+			bw.writeBits(uint32(first), 1)
+		} else {
+			bw.writeBits(1, 1)
+			bw.writeBits(uint32(first), 8)
+		}
+		if len(h.used) == 2 {
+			bw.writeBits(uint32(h.used[1]), 8)
+		}
+		return
+	}
+
+	bw.writeBits(0, 1)
+
+	clFreqs := make([]uint32, len(codeLengthOrder))
+	for _, l := range h.lengths {
+		clFreqs[l]++
+	}
+	lengthCode := newHuffmanCode(clFreqs, 7)
+
+	n := len(codeLengthOrder)
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+	bw.writeBits(uint32(n-4), 4)
+	for _, symbol := range codeLengthOrder[:n] {
+		bw.writeBits(uint32(lengthCode.lengths[symbol]), 3)
+	}
+
+	// Code lengths cover the whole alphabet
+	bw.writeBits(0, 1)
+	for _, l := range h.lengths {
+		lengthCode.writeSymbol(bw, int(l))
+	}
+}
+
+func (h *huffmanCode) writeSymbol(bw *bitWriter, symbol int) {
+	// Decoders read zero bits for codes with a single symbol
+	if len(h.used) == 1 {
+		return
+	}
+	bw.writeBits(uint32(h.codes[symbol]), uint(h.lengths[symbol]))
+}
+
+type huffmanNode struct {
+	weight uint32
+	order  int
+	symbol int
+	left   int
+	right  int
+}
+
+type huffmanHeap struct {
+	nodes []huffmanNode
+	items []int
+}
+
+func (h *huffmanHeap) Len() int { return len(h.items) }
+func (h *huffmanHeap) Less(i, j int) bool {
+	a, b := h.nodes[h.items[i]], h.nodes[h.items[j]]
+	if a.weight != b.weight {
+		return a.weight < b.weight
+	}
+	return a.order < b.order
+}
+func (h *huffmanHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *huffmanHeap) Push(x any)    { h.items = append(h.items, x.(int)) }
+func (h *huffmanHeap) Pop() any {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
+
+// huffmanLengths computes code lengths no longer than maxLength. When the
+// tree gets too deep, small frequencies are raised and the tree rebuilt.
+func huffmanLengths(freqs []uint32, maxLength int) []uint8 {
+	lengths := make([]uint8, len(freqs))
+
+	for minWeight := uint32(1); ; minWeight *= 2 {
+		h := &huffmanHeap{}
+		for symbol, f := range freqs {
+			if f == 0 {
+				continue
+			}
+			h.nodes = append(h.nodes, huffmanNode{weight: max(f, minWeight), order: symbol, symbol: symbol, left: -1, right: -1})
+			h.items = append(h.items, len(h.nodes)-1)
+		}
+
+		if len(h.items) == 1 {
+			lengths[h.nodes[0].symbol] = 1
+			return lengths
+		}
+
+		heap.Init(h)
+		for h.Len() > 1 {
+			a := heap.Pop(h).(int)
+			b := heap.Pop(h).(int)
+			h.nodes = append(h.nodes, huffmanNode{
+				weight: h.nodes[a].weight + h.nodes[b].weight,
+				order:  len(freqs) + len(h.nodes),
+				symbol: -1,
+				left:   a,
+				right:  b,
+			})
+			heap.Push(h, len(h.nodes)-1)
+		}
+
+		clear(lengths)
+		maxDepth := 0
+		var walk func(node, depth int)
+		walk = func(node, depth int) {
+			n := h.nodes[node]
+			if n.left < 0 {
+				lengths[n.symbol] = uint8(depth)
+				maxDepth = max(maxDepth, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h.items[0], 0)
+
+		if maxDepth <= maxLength {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical Huffman codes, bit-reversed because the
+// stream is read least significant bit first.
+func canonicalCodes(lengths []uint8) []uint16 {
+	var counts [16]int
+	for _, l := range lengths {
+		if l > 0 {
+			counts[l]++
+		}
+	}
+
+	var next [16]int
+	code := 0
+	for l := 1; l < len(next); l++ {
+		code = (code + counts[l-1]) << 1
+		next[l] = code
+	}
+
+	codes := make([]uint16, len(lengths))
+	for symbol, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[symbol] = reverseBits(uint16(next[l]), l)
+		next[l]++
+	}
+
+	return codes
+}
+
+func reverseBits(v uint16, n uint8) uint16 {
+	var r uint16
+	for range n {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package raster
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand/v2"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func TestEncodeWebPRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+	}{
+		{"single pixel", filled(1, 1, color.NRGBA{R: 200, G: 10, B: 30, A: 255})},
+		{"solid color", filled(64, 32, color.NRGBA{R: 12, G: 34, B: 56, A: 255})},
+		{"two colors", stripes(17, 9)},
+		{"gradient", gradient(256, 3)},
+		{"translucent", filled(5, 7, color.NRGBA{R: 255, G: 128, B: 0, A: 100})},
+		{"noise", noise(97, 61)},
+		{"offset bounds", image.NewNRGBA(image.Rect(10, 20, 13, 24))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeWebP(&buf, tt.img); err != nil {
+				t.Fatalf("encodeWebP: %v", err)
+			}
+
+			got, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+
+			b := tt.img.Bounds()
+			if got.Bounds().Dx() != b.Dx() || got.Bounds().Dy() != b.Dy() {
+				t.Fatalf("size = %v, want %v", got.Bounds().Size(), b.Size())
+			}
+
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := color.NRGBAModel.Convert(tt.img.At(b.Min.X+x, b.Min.Y+y))
+					have := color.NRGBAModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y))
+					if have != want {
+						t.Fatalf("pixel (%d, %d) = %v, want %v", x, y, have, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeWebPRejectsDimensions(t *testing.T) {
+	tests := []struct {
+		name string
+		rect image.Rectangle
+	}{
+		{"empty", image.Rect(0, 0, 0, 0)},
+		{"too wide", image.Rect(0, 0, vp8lMaxDimension+1, 1)},
+		{"too tall", image.Rect(0, 0, 1, vp8lMaxDimension+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the bounds are read before the size check
+			img := image.NewUniform(color.Black)
+			if err := encodeWebP(&bytes.Buffer{}, boundedImage{img, tt.rect}); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestHuffmanLengths(t *testing.T) {
+	tests := []struct {
+		name      string
+		freqs     []uint32
+		maxLength int
+	}{
+		{"single symbol", []uint32{0, 0, 5}, 15},
+		{"two symbols", []uint32{3, 0, 1}, 15},
+		{"uniform", []uint32{1, 1, 1, 1, 1, 1, 1, 1}, 15},
+		{"skewed", []uint32{1000, 1, 1, 1, 1, 1, 1, 1, 1}, 15},
+		{"fibonacci capped", fibonacci(30), 15},
+		{"code length alphabet", fibonacci(19), 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lengths := huffmanLengths(tt.freqs, tt.maxLength)
+
+			used := 0
+			kraft := 0.0
+			for symbol, l := range lengths {
+				if tt.freqs[symbol] == 0 {
+					if l != 0 {
+						t.Fatalf("unused symbol %d has length %d", symbol, l)
+					}
+					continue
+				}
+				if l == 0 || int(l) > tt.maxLength {
+					t.Fatalf("symbol %d has length %d, want 1..%d", symbol, l, tt.maxLength)
+				}
+				used++
+				kraft += 1 / float64(uint64(1)<<l)
+			}
+
+			// A complete code, except that a lone symbol takes one bit
+			if used > 1 && kraft != 1 {
+				t.Fatalf("Kraft sum = %v, want 1", kraft)
+			}
+		})
+	}
+}
+
+func TestCanonicalCodesArePrefixFree(t *testing.T) {
+	lengths := huffmanLengths(fibonacci(20), 15)
+	codes := canonicalCodes(lengths)
+
+	// Codes are stored bit-reversed, so their first bits are the low ones
+	for a := range codes {
+		for b := range codes {
+			if a == b || lengths[a] == 0 || lengths[b] == 0 || lengths[a] > lengths[b] {
+				continue
+			}
+			mask := uint16(1)<<lengths[a] - 1
+			if codes[b]&mask == codes[a] {
+				t.Fatalf("code of %d is a prefix of the code of %d", a, b)
+			}
+		}
+	}
+}
+
+type boundedImage struct {
+	image.Image
+	bounds image.Rectangle
+}
+
+func (b boundedImage) Bounds() image.Rectangle { return b.bounds }
+
+func filled(w, h int, c color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func stripes(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			if x%2 == 0 {
+				img.SetNRGBA(x, y, color.NRGBA{R: 255, A: 255})
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func gradient(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x), G: uint8(255 - x), B: uint8(x * y), A: uint8(255 - y)})
+		}
+	}
+	return img
+}
+
+func noise(w, h int) *image.NRGBA {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.UintN(256))
+	}
+	return img
+}
+
+func fibonacci(n int) []uint32 {
+	freqs := make([]uint32, n)
+	a, b := uint32(1), uint32(1)
+	for i := range freqs {
+		freqs[i] = a
+		a, b = b, a+b
+	}
+	return freqs
+}
@@ -0,0 +1,157 @@
+package svg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"github.com/meraf00/swytch/internal/pipeline/infra/converter/raster"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+const (
+	// SVG user units are CSS pixels, defined at 96 DPI
+	baseDPI = 96
+
+	maxDimension = 16384
+)
+
+func init() {
+	for _, target := range raster.Formats() {
+		domain.RegisterConverter(&Converter{target: target})
+	}
+}
+
+// Converter rasterizes SVG documents.
+//
+// Options:
+//   - width, height: output size in pixels; a missing side keeps the aspect ratio
+//   - dpi: scale relative to 96 DPI when no size is given
+//   - background, quality: as for raster targets
+type Converter struct {
+	target string
+}
+
+func (c *Converter) SourceFormat() string { return "svg" }
+func (c *Converter) TargetFormat() string { return c.target }
+func (c *Converter) Class() string        { return "image" }
+
+func (c *Converter) ValidateOptions(opts domain.ConversionOptions) error {
+	if err := ValidateSizeOptions(opts); err != nil {
+		return err
+	}
+
+	if _, err := raster.Quality(opts); err != nil {
+		return err
+	}
+	_, err := raster.Background(opts)
+	return err
+}
+
+func (c *Converter) Convert(ctx context.Context, in io.Reader, out io.Writer, opts domain.ConversionOptions) error {
+	img, err := Rasterize(in, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return raster.Encode(out, img, c.target, opts)
+}
+
+// Rasterize renders an SVG document at the size given by the width, height
+// and dpi options.
+func Rasterize(in io.Reader, opts domain.ConversionOptions) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(in, oksvg.WarnErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse svg: %w", err)
+	}
+
+	width, height, err := outputSize(icon.ViewBox.W, icon.ViewBox.H, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+
+	return img, nil
+}
+
+// ValidateSizeOptions checks the options read by Rasterize.
+func ValidateSizeOptions(opts domain.ConversionOptions) error {
+	for _, key := range []string{"width", "height", "dpi"} {
+		if _, err := positiveOption(opts, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outputSize resolves the pixel size from the intrinsic size and options.
+// Explicit width and height win over dpi.
+func outputSize(intrinsicW, intrinsicH float64, opts domain.ConversionOptions) (int, int, error) {
+	if intrinsicW <= 0 || intrinsicH <= 0 {
+		return 0, 0, fmt.Errorf("svg has no usable size; set width or height")
+	}
+
+	width, err := positiveOption(opts, "width")
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := positiveOption(opts, "height")
+	if err != nil {
+		return 0, 0, err
+	}
+	dpi, err := positiveOption(opts, "dpi")
+	if err != nil {
+		return 0, 0, err
+	}
+
+	switch {
+	case width > 0 && height > 0:
+	case width > 0:
+		height = width * intrinsicH / intrinsicW
+	case height > 0:
+		width = height * intrinsicW / intrinsicH
+	default:
+		scale := 1.0
+		if dpi > 0 {
+			scale = dpi / baseDPI
+		}
+		width = intrinsicW * scale
+		height = intrinsicH * scale
+	}
+
+	w, h := int(math.Round(width)), int(math.Round(height))
+	if w < 1 || h < 1 || w > maxDimension || h > maxDimension {
+		return 0, 0, fmt.Errorf("output size %dx%d is out of range", w, h)
+	}
+	if err := raster.CheckSize(w, h); err != nil {
+		return 0, 0, err
+	}
+
+	return w, h, nil
+}
+
+func positiveOption(opts domain.ConversionOptions, key string) (float64, error) {
+	value, ok := opts[key]
+	if !ok {
+		return 0, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%s must be a positive number", key)
+	}
+	return f, nil
+}
@@ -0,0 +1,23 @@
+package infra
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/meraf00/swytch/core/lib/apperror"
+)
+
+var (
+	errJobNotFound  = apperror.NotFound("job not found", "job_not_found", nil)
+	errTaskNotFound = apperror.NotFound("task not found", "task_not_found", nil)
+	// Object names of other owners are reported the same as unknown ones
+	errObjectNotUploaded = apperror.BadRequest("object was not uploaded by this owner", "object_not_uploaded", nil)
+)
+
+// notFoundOr maps a missing row to notFound and passes other errors through.
+func notFoundOr(err error, notFound error) error {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound
+	}
+	return err
+}
@@ -2,56 +2,58 @@ package infra
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/meraf00/swytch/core"
 	"github.com/meraf00/swytch/core/db"
 	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/apperror"
 	"github.com/meraf00/swytch/core/lib/hashids"
 	"github.com/meraf00/swytch/internal/pipeline/domain"
 )
 
 type JobRepositoryPG struct {
-	db core.Database
-	hs hashids.HashID
+	db        core.Database
+	hs        hashids.HashID
+	taskQueue string
 }
 
-func NewJobRepositoryPG(db core.Database, hs hashids.HashID) *JobRepositoryPG {
+func NewJobRepositoryPG(db core.Database, hs hashids.HashID, taskQueue string) *JobRepositoryPG {
 	return &JobRepositoryPG{
-		db: db,
-		hs: hs,
+		db:        db,
+		hs:        hs,
+		taskQueue: taskQueue,
 	}
 }
 
-func (r *JobRepositoryPG) GetJobByID(ctx context.Context, jobID string) (*domain.Job, error) {
-	var job *domain.Job
-
+func (r *JobRepositoryPG) GetJobByID(ctx context.Context, ownerID, jobID string) (*domain.Job, error) {
 	jobIDInt, err := r.hs.DecodeID(jobID)
 	if err != nil {
-		return nil, err
+		return nil, errJobNotFound
 	}
 
-	j, err := r.db.Queries().GetJobByID(ctx, int32(jobIDInt))
+	j, err := r.db.Queries().GetJobByID(ctx, sql.GetJobByIDParams{
+		ID:      int32(jobIDInt),
+		OwnerID: ownerID,
+	})
 	if err != nil {
-		return nil, err
+		return nil, notFoundOr(err, errJobNotFound)
 	}
 
-	job = &domain.Job{
-		ID:        jobID,
-		CreatedAt: j.CreatedAt.Time,
-		UpdatedAt: j.UpdatedAt.Time,
-	}
-
-	return job, nil
+	return jobFromRow(jobID, j), nil
 }
 
-func (r *JobRepositoryPG) GetJobWithTasksAndFiles(ctx context.Context, jobID string) (*domain.Job, error) {
+func (r *JobRepositoryPG) GetJobWithTasksAndFiles(ctx context.Context, ownerID, jobID string) (*domain.Job, error) {
 	jobIDInt, err := r.hs.DecodeID(jobID)
 	if err != nil {
-		return nil, err
+		return nil, errJobNotFound
 	}
 
-	job, err := r.GetJobByID(ctx, jobID)
+	job, err := r.GetJobByID(ctx, ownerID, jobID)
 	if err != nil {
 		return nil, err
 	}
@@ -64,39 +66,127 @@ func (r *JobRepositoryPG) GetJobWithTasksAndFiles(ctx context.Context, jobID str
 	job.Tasks = make([]domain.Task, len(tasks))
 
 	for i, t := range tasks {
-		taskID, err := r.hs.EncodeID(uint(t.ID))
+		task, err := jobTaskFromRow(r.hs, jobID, t)
 		if err != nil {
 			return nil, err
 		}
+		job.Tasks[i] = *task
+	}
+
+	return job, nil
+}
+
+var errInvalidCursor = apperror.BadRequest("invalid cursor", "invalid_cursor", nil)
+
+// jobCursor is the position after the last job of a page. It is handed to
+// clients as opaque base64.
+type jobCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+// ListJobs returns a page of the owner's jobs, newest first unless the
+// filter asks otherwise.
+func (r *JobRepositoryPG) ListJobs(ctx context.Context, ownerID string, filter *domain.JobFilter) (*domain.JobPage, error) {
+	params := sql.ListJobsNewestFirstParams{
+		OwnerID:       ownerID,
+		Status:        db.ToPGText(string(filter.Status)),
+		CreatedAfter:  db.ToPGTimestamptz(filter.CreatedAfter),
+		CreatedBefore: db.ToPGTimestamptz(filter.CreatedBefore),
+		FileName:      db.ToPGText(escapeLike(filter.FileName)),
+		// One extra row tells whether another page follows
+		PageSize: int32(filter.Limit) + 1,
+	}
+
+	if filter.Cursor != "" {
+		createdAt, id, err := r.decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		params.CursorCreatedAt = db.ToPGTimestamptz(createdAt)
+		params.CursorID = db.ToPGInt4(id)
+	}
+
+	// One static query per direction keeps the listing on the owner index
+	var rows []sql.JobSummary
+	var err error
+	if filter.OldestFirst {
+		rows, err = r.db.Queries().ListJobsOldestFirst(ctx, sql.ListJobsOldestFirstParams(params))
+	} else {
+		rows, err = r.db.Queries().ListJobsNewestFirst(ctx, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	page := &domain.JobPage{}
+	hasMore := len(rows) > filter.Limit
+	if hasMore {
+		rows = rows[:filter.Limit]
+	}
 
-		fileID, err := r.hs.EncodeID(uint(t.File.ID))
+	page.Jobs = make([]domain.Job, len(rows))
+	for i, row := range rows {
+		jobID, err := r.hs.EncodeID(uint(row.ID))
 		if err != nil {
 			return nil, err
 		}
 
-		job.Tasks[i] = domain.Task{
-			ID:           taskID,
-			TargetFormat: t.TargetFormat,
-			Status:       domain.TaskStatus(t.Status.TaskStatus),
-			File: domain.File{
-				ID:             fileID,
-				ObjectName:     t.File.ObjectName.String(),
-				OriginalName:   t.File.OriginalName,
-				OriginalFormat: t.File.OriginalFormat,
-			},
-			CreatedAt: t.CreatedAt.Time,
-			UpdatedAt: t.UpdatedAt.Time,
+		page.Jobs[i] = *jobFromRow(jobID, row)
+	}
+
+	if hasMore {
+		last := page.Jobs[len(page.Jobs)-1]
+		page.NextCursor, err = encodeCursor(jobCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return job, nil
+	return page, nil
+}
+
+func encodeCursor(c jobCursor) (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func (r *JobRepositoryPG) decodeCursor(s string) (time.Time, int32, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	var c jobCursor
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	id, err := r.hs.DecodeID(c.ID)
+	if err != nil {
+		return time.Time{}, 0, errInvalidCursor
+	}
+
+	return c.CreatedAt, int32(id), nil
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
 func (r *JobRepositoryPG) CreateJob(ctx context.Context, job *domain.Job) (*domain.Job, error) {
 	var newJob *domain.Job
 
 	err := r.db.WithTransaction(ctx, func(q *sql.Queries) error {
-		j, err := q.CreateJob(ctx)
+		j, err := q.CreateJob(ctx, sql.CreateJobParams{
+			OwnerID:     job.OwnerID,
+			CallbackUrl: db.ToPGText(job.CallbackURL),
+			Priority:    sql.JobPriority(job.Priority),
+		})
 		if err != nil {
 			return err
 		}
@@ -104,47 +194,58 @@ func (r *JobRepositoryPG) CreateJob(ctx context.Context, job *domain.Job) (*doma
 		for i := range job.Tasks {
 			t := &job.Tasks[i]
 
-			var objectName pgtype.UUID
-			err := objectName.Scan(t.File.ObjectName)
-			if err != nil {
-				return err
+			sources := t.Sources()
+			fileIDs := make([]int32, len(sources))
+			for k := range sources {
+				sources[k].OwnerID = job.OwnerID
+				f, err := r.createFile(ctx, q, &sources[k])
+				if err != nil {
+					return err
+				}
+				fileIDs[k] = f.ID
 			}
+			t.File = sources[0]
 
-			f, err := q.CreateFile(ctx, sql.CreateFileParams{
-				ObjectName:     objectName,
-				OriginalName:   t.File.OriginalName,
-				OriginalFormat: t.File.OriginalFormat,
-			})
-			if err != nil {
-				return err
-			}
+			t.Status = domain.StatusPending
 
-			t.File.ID, err = r.hs.EncodeID(uint(f.ID))
+			options, err := encodeOptions(t.Options)
 			if err != nil {
 				return err
 			}
 
-			t.File.ObjectName = objectName.String()
-			t.File.OriginalName = f.OriginalName
-			t.File.OriginalFormat = f.OriginalFormat
-
-			t.Status = domain.StatusPending
-
 			task, err := q.CreateTask(ctx, sql.CreateTaskParams{
 				JobID:        db.ToPGInt4(j.ID),
-				FileID:       db.ToPGInt4(f.ID),
+				FileID:       db.ToPGInt4(fileIDs[0]),
 				TargetFormat: t.TargetFormat,
+				Options:      options,
 			})
 			if err != nil {
 				return err
 			}
 
+			if t.IsMerge() {
+				for position, fileID := range fileIDs {
+					err := q.CreateTaskInput(ctx, sql.CreateTaskInputParams{
+						TaskID:   task.ID,
+						FileID:   fileID,
+						Position: int32(position),
+					})
+					if err != nil {
+						return err
+					}
+				}
+			}
+
 			taskID, err := r.hs.EncodeID(uint(task.ID))
 			if err != nil {
 				return err
 			}
 			t.ID = taskID
 			t.TargetFormat = task.TargetFormat
+
+			if err := enqueueTask(ctx, q, r.taskQueue, task.ID, t, domain.JobPriority(j.Priority)); err != nil {
+				return err
+			}
 		}
 
 		jobID, err := r.hs.EncodeID(uint(j.ID))
@@ -152,10 +253,13 @@ func (r *JobRepositoryPG) CreateJob(ctx context.Context, job *domain.Job) (*doma
 			return err
 		}
 		newJob = &domain.Job{
-			ID:        jobID,
-			CreatedAt: j.CreatedAt.Time,
-			UpdatedAt: j.UpdatedAt.Time,
-			Tasks:     job.Tasks,
+			ID:          jobID,
+			OwnerID:     j.OwnerID,
+			Priority:    domain.JobPriority(j.Priority),
+			CallbackURL: j.CallbackUrl.String,
+			CreatedAt:   j.CreatedAt.Time,
+			UpdatedAt:   j.UpdatedAt.Time,
+			Tasks:       job.Tasks,
 		}
 
 		return nil
@@ -167,3 +271,102 @@ func (r *JobRepositoryPG) CreateJob(ctx context.Context, job *domain.Job) (*doma
 
 	return newJob, nil
 }
+
+func (r *JobRepositoryPG) createFile(ctx context.Context, q *sql.Queries, file *domain.File) (*sql.File, error) {
+	var objectName pgtype.UUID
+	if err := objectName.Scan(file.ObjectName); err != nil {
+		return nil, errObjectNotUploaded
+	}
+
+	// Only objects the owner uploaded may be converted
+	_, err := q.GetUpload(ctx, sql.GetUploadParams{
+		ObjectName: objectName,
+		OwnerID:    file.OwnerID,
+	})
+	if err != nil {
+		return nil, notFoundOr(err, errObjectNotUploaded)
+	}
+
+	f, err := q.CreateFile(ctx, sql.CreateFileParams{
+		ObjectName:     objectName,
+		OriginalName:   file.OriginalName,
+		OriginalFormat: file.OriginalFormat,
+		OwnerID:        file.OwnerID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file.ID, err = r.hs.EncodeID(uint(f.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	file.ObjectName = objectName.String()
+	file.OriginalName = f.OriginalName
+	file.OriginalFormat = f.OriginalFormat
+
+	return &f, nil
+}
+
+// jobFromRow maps a job and the summary of its tasks.
+func jobFromRow(jobID string, row sql.JobSummary) *domain.Job {
+	return &domain.Job{
+		ID:       jobID,
+		OwnerID:  row.OwnerID,
+		Status:   domain.JobStatus(row.Status),
+		Priority: domain.JobPriority(row.Priority),
+		TaskCounts: domain.TaskCounts{
+			Total:      int(row.TotalTasks),
+			Pending:    int(row.PendingTasks),
+			Processing: int(row.ProcessingTasks),
+			Completed:  int(row.CompletedTasks),
+			Failed:     int(row.FailedTasks),
+			Cancelled:  int(row.CancelledTasks),
+		},
+		CallbackURL: row.CallbackUrl.String,
+		StartedAt:   row.StartedAt.Time,
+		FinishedAt:  row.FinishedAt.Time,
+		CreatedAt:   row.CreatedAt.Time,
+		UpdatedAt:   row.UpdatedAt.Time,
+	}
+}
+
+func jobTaskFromRow(hs hashids.HashID, jobID string, t sql.GetTasksByJobIDRow) (*domain.Task, error) {
+	taskID, err := hs.EncodeID(uint(t.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	fileID, err := hs.EncodeID(uint(t.File.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := decodeOptions(t.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Task{
+		ID:                taskID,
+		JobID:             jobID,
+		TargetFormat:      t.TargetFormat,
+		Options:           options,
+		ConvertedFileName: t.ConvertedFileName.String,
+		Status:            domain.TaskStatus(t.Status.TaskStatus),
+		ErrorMessage:      t.ErrorMessage.String,
+		Attempts:          int(t.Attempts),
+		File: domain.File{
+			ID:             fileID,
+			ObjectName:     t.File.ObjectName.String(),
+			OriginalName:   t.File.OriginalName,
+			OriginalFormat: t.File.OriginalFormat,
+			OwnerID:        t.File.OwnerID,
+		},
+		StartedAt:   t.StartedAt.Time,
+		CompletedAt: t.CompletedAt.Time,
+		CreatedAt:   t.CreatedAt.Time,
+		UpdatedAt:   t.UpdatedAt.Time,
+	}, nil
+}
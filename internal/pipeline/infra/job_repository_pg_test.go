@@ -0,0 +1,90 @@
+package infra
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/lib/hashids"
+)
+
+func TestJobCursorRoundTrip(t *testing.T) {
+	hs, err := hashids.NewHashIDService(core.EncryptionConfig{HashSalt: "test-salt"})
+	if err != nil {
+		t.Fatalf("hashids: %v", err)
+	}
+	r := &JobRepositoryPG{hs: hs}
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		id        uint
+	}{
+		{"utc", time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC), 1},
+		{"microseconds", time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC), 42},
+		{"offset", time.Date(2026, 5, 1, 12, 0, 0, 0, time.FixedZone("", 3*60*60)), 7},
+		{"large id", time.Date(2025, 12, 31, 23, 59, 59, 999999000, time.UTC), 1 << 30},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := hs.EncodeID(tt.id)
+			if err != nil {
+				t.Fatalf("encode id: %v", err)
+			}
+
+			cursor, err := encodeCursor(jobCursor{CreatedAt: tt.createdAt, ID: id})
+			if err != nil {
+				t.Fatalf("encodeCursor: %v", err)
+			}
+
+			createdAt, gotID, err := r.decodeCursor(cursor)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if !createdAt.Equal(tt.createdAt) {
+				t.Errorf("created at = %v, want %v", createdAt, tt.createdAt)
+			}
+			if gotID != int32(tt.id) {
+				t.Errorf("id = %d, want %d", gotID, tt.id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejectsGarbage(t *testing.T) {
+	hs, err := hashids.NewHashIDService(core.EncryptionConfig{HashSalt: "test-salt"})
+	if err != nil {
+		t.Fatalf("hashids: %v", err)
+	}
+	r := &JobRepositoryPG{hs: hs}
+
+	other, err := hashids.NewHashIDService(core.EncryptionConfig{HashSalt: "other-salt"})
+	if err != nil {
+		t.Fatalf("hashids: %v", err)
+	}
+	foreignID, _ := other.EncodeID(5)
+
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"c":"2026-10-16T09:30:00Z","i":"x"}`))},
+		{"not json", encode("not json")},
+		{"bad time", encode(`{"c":"yesterday","i":"x"}`)},
+		{"bad id", encode(`{"c":"2026-10-16T09:30:00Z","i":"!!"}`)},
+		{"id of another salt", encode(`{"c":"2026-10-16T09:30:00Z","i":"` + foreignID + `"}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := r.decodeCursor(tt.cursor); err != errInvalidCursor {
+				t.Fatalf("err = %v, want errInvalidCursor", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package infra
+
+import (
+	"context"
+	"time"
+
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/logger"
+)
+
+// OutboxRelay publishes messages written to the outbox table and marks them
+// as sent. Rows are locked while being relayed, so several relays can run
+// side by side without publishing the same row twice.
+//
+// Owners take turns: each batch holds the next message of every owner
+// before the second of any, so one owner's backlog does not hold back the
+// others. An owner's messages go by job priority, then age. Owners with
+// maxInFlight tasks in the broker or with workers get no more until some of
+// them finish.
+//
+// A message that fails to publish is retried with backoff without holding
+// up the others. The rest of its queue is left for the next batch rather
+// than sent to a failing queue right away.
+type OutboxRelay struct {
+	db          core.Database
+	mq          broker.Broker
+	log         logger.Log
+	interval    time.Duration
+	batchSize   int
+	maxInFlight int
+}
+
+func NewOutboxRelay(db core.Database, mq broker.Broker, cfg core.OutboxConfig, log logger.Log) *OutboxRelay {
+	return &OutboxRelay{
+		db:          db,
+		mq:          mq,
+		log:         log.Named("outbox-relay"),
+		interval:    cfg.PollInterval,
+		batchSize:   cfg.BatchSize,
+		maxInFlight: cfg.MaxInFlightPerOwner,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled. Full batches are followed
+// immediately by the next one so a backlog drains without waiting.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		sent, err := r.relayBatch(ctx)
+		if err != nil {
+			r.log.Errorf("Failed to relay outbox messages: %v", err)
+		}
+
+		if err == nil && sent == r.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *OutboxRelay) relayBatch(ctx context.Context) (int, error) {
+	sent := 0
+
+	err := r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		messages, err := q.GetUnsentOutboxMessages(ctx, sql.GetUnsentOutboxMessagesParams{
+			MaxInFlight: int32(r.maxInFlight),
+			BatchSize:   int32(r.batchSize),
+		})
+		if err != nil {
+			return err
+		}
+
+		failedQueues := make(map[string]bool)
+		for _, m := range messages {
+			if failedQueues[m.Queue] {
+				continue
+			}
+
+			if err := r.mq.Publish(ctx, m.Queue, broker.Message{Body: m.Payload}); err != nil {
+				r.log.Warnf("Failed to publish outbox message %d: %v", m.ID, err)
+				failedQueues[m.Queue] = true
+				err := q.MarkOutboxMessageFailed(ctx, sql.MarkOutboxMessageFailedParams{
+					ID:            m.ID,
+					LastError:     db.ToPGText(err.Error()),
+					NextAttemptAt: db.ToPGTimestamptz(time.Now().Add(r.backoff(int(m.Attempts) + 1))),
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := q.MarkOutboxMessageSent(ctx, m.ID); err != nil {
+				return err
+			}
+			sent++
+		}
+
+		return nil
+	})
+
+	return sent, err
+}
+
+// maxPublishBackoff caps the wait before retrying a message that failed to
+// publish.
+const maxPublishBackoff = time.Minute
+
+// backoff doubles the poll interval with every failed attempt.
+func (r *OutboxRelay) backoff(attempt int) time.Duration {
+	delay := r.interval
+	for i := 1; i < attempt && delay < maxPublishBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxPublishBackoff)
+}
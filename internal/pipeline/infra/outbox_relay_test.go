@@ -0,0 +1,206 @@
+package infra
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+)
+
+// testQueries runs against TEST_POSTGRES_DSN inside a throwaway schema
+// created from schema.sql, rolled back when the test ends.
+func testQueries(t *testing.T) (*sql.Queries, pgx.Tx) {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN not set")
+	}
+
+	schema, err := os.ReadFile("../../../core/db/schema/schema.sql")
+	if err != nil {
+		t.Fatalf("read schema: %v", err)
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close(ctx) })
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback(ctx) })
+
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	setup := fmt.Sprintf("CREATE SCHEMA %s; SET LOCAL search_path TO %s;\n%s", name, name, schema)
+	if _, err := tx.Exec(ctx, setup); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+
+	return sql.New(tx), tx
+}
+
+func TestGetUnsentOutboxMessagesFairness(t *testing.T) {
+	type message struct {
+		// owner is empty for messages without a task
+		owner    string
+		priority sql.JobPriority
+		// sent messages count against their owner while the task is pending
+		sent bool
+		// delayed messages are backing off after a failed publish
+		delayed bool
+	}
+
+	normal := func(owner string) message { return message{owner: owner, priority: sql.JobPriorityNormal} }
+
+	tests := []struct {
+		name        string
+		messages    []message
+		maxInFlight int32
+		batchSize   int32
+		// want lists the indexes of the returned messages in order
+		want []int
+	}{
+		{
+			name:      "owners take turns",
+			messages:  []message{normal("a"), normal("a"), normal("a"), normal("b")},
+			batchSize: 10,
+			want:      []int{0, 3, 1, 2},
+		},
+		{
+			name: "urgent messages go first within an owner",
+			messages: []message{
+				{owner: "a", priority: sql.JobPriorityBulk},
+				{owner: "a", priority: sql.JobPriorityInteractive},
+				normal("b"),
+			},
+			batchSize: 10,
+			want:      []int{1, 2, 0},
+		},
+		{
+			name:      "batch size cuts the last turns",
+			messages:  []message{normal("a"), normal("a"), normal("b")},
+			batchSize: 2,
+			want:      []int{0, 2},
+		},
+		{
+			name: "in flight tasks use up an owner's limit",
+			messages: []message{
+				{owner: "a", priority: sql.JobPriorityNormal, sent: true},
+				{owner: "a", priority: sql.JobPriorityNormal, sent: true},
+				normal("a"),
+				normal("a"),
+				normal("b"),
+			},
+			maxInFlight: 3,
+			batchSize:   10,
+			want:        []int{2, 4},
+		},
+		{
+			name: "no limit without max in flight",
+			messages: []message{
+				{owner: "a", priority: sql.JobPriorityNormal, sent: true},
+				normal("a"),
+				normal("a"),
+				normal("b"),
+			},
+			batchSize: 10,
+			want:      []int{1, 3, 2},
+		},
+		{
+			name: "backed off messages wait",
+			messages: []message{
+				{owner: "a", priority: sql.JobPriorityNormal, delayed: true},
+				normal("a"),
+			},
+			batchSize: 10,
+			want:      []int{1},
+		},
+		{
+			name:        "messages without a task are never limited",
+			messages:    []message{normal(""), normal(""), normal("a"), normal("a")},
+			maxInFlight: 1,
+			batchSize:   10,
+			want:        []int{0, 2, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q, tx := testQueries(t)
+
+			ids := make([]int64, len(tt.messages))
+			for i, m := range tt.messages {
+				params := sql.CreateOutboxMessageParams{
+					Queue:    "tasks",
+					Payload:  []byte("{}"),
+					Priority: m.priority,
+				}
+
+				if m.owner != "" {
+					var taskID int32
+					err := tx.QueryRow(ctx, `
+						WITH job AS (
+							INSERT INTO jobs (owner_id, priority) VALUES ($1, $2) RETURNING id
+						)
+						INSERT INTO tasks (job_id, target_format, status)
+						SELECT id, 'png', 'pending' FROM job
+						RETURNING id`, m.owner, m.priority).Scan(&taskID)
+					if err != nil {
+						t.Fatalf("create task: %v", err)
+					}
+					params.TaskID = db.ToPGInt4(taskID)
+				}
+
+				msg, err := q.CreateOutboxMessage(ctx, params)
+				if err != nil {
+					t.Fatalf("create message: %v", err)
+				}
+				ids[i] = msg.ID
+
+				if m.sent {
+					if err := q.MarkOutboxMessageSent(ctx, msg.ID); err != nil {
+						t.Fatalf("mark sent: %v", err)
+					}
+				}
+				if m.delayed {
+					err := q.MarkOutboxMessageFailed(ctx, sql.MarkOutboxMessageFailedParams{
+						ID:            msg.ID,
+						LastError:     db.ToPGText("broker unavailable"),
+						NextAttemptAt: db.ToPGTimestamptz(time.Now().Add(time.Hour)),
+					})
+					if err != nil {
+						t.Fatalf("mark failed: %v", err)
+					}
+				}
+			}
+
+			got, err := q.GetUnsentOutboxMessages(ctx, sql.GetUnsentOutboxMessagesParams{
+				MaxInFlight: tt.maxInFlight,
+				BatchSize:   tt.batchSize,
+			})
+			if err != nil {
+				t.Fatalf("GetUnsentOutboxMessages: %v", err)
+			}
+
+			gotIdx := make([]int, len(got))
+			for i, m := range got {
+				gotIdx[i] = slices.Index(ids, m.ID)
+			}
+			if !slices.Equal(gotIdx, tt.want) {
+				t.Fatalf("got messages %v, want %v", gotIdx, tt.want)
+			}
+		})
+	}
+}
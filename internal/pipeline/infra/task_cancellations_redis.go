@@ -0,0 +1,91 @@
+package infra
+
+import (
+	"context"
+	"sync"
+
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const taskCancellationsChannel = "tasks:cancelled"
+
+// TaskCancellationsRedis broadcasts task cancellations over Redis pub/sub.
+// The API signals them; every worker listens and interrupts the matching
+// tasks it is running.
+type TaskCancellationsRedis struct {
+	rdb *redis.Client
+	log logger.Log
+
+	mu      sync.Mutex
+	watches map[string]map[*taskWatch]struct{}
+}
+
+type taskWatch struct {
+	cancel context.CancelFunc
+}
+
+func NewTaskCancellationsRedis(rdb *redis.Client, log logger.Log) *TaskCancellationsRedis {
+	return &TaskCancellationsRedis{
+		rdb:     rdb,
+		log:     log.Named("task-cancellations"),
+		watches: make(map[string]map[*taskWatch]struct{}),
+	}
+}
+
+func (c *TaskCancellationsRedis) SignalTaskCancelled(ctx context.Context, taskID string) error {
+	return c.rdb.Publish(ctx, taskCancellationsChannel, taskID).Err()
+}
+
+func (c *TaskCancellationsRedis) WatchTaskCancellation(ctx context.Context, taskID string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &taskWatch{cancel: cancel}
+
+	c.mu.Lock()
+	if c.watches[taskID] == nil {
+		c.watches[taskID] = make(map[*taskWatch]struct{})
+	}
+	c.watches[taskID][w] = struct{}{}
+	c.mu.Unlock()
+
+	return ctx, func() {
+		c.mu.Lock()
+		delete(c.watches[taskID], w)
+		if len(c.watches[taskID]) == 0 {
+			delete(c.watches, taskID)
+		}
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// Run listens for cancellations until ctx is cancelled. The Redis client
+// resubscribes by itself after connection loss; signals sent meanwhile are
+// lost.
+func (c *TaskCancellationsRedis) Run(ctx context.Context) {
+	pubsub := c.rdb.Subscribe(ctx, taskCancellationsChannel)
+	defer pubsub.Close()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				return
+			}
+			c.cancel(msg.Payload)
+		}
+	}
+}
+
+func (c *TaskCancellationsRedis) cancel(taskID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for w := range c.watches[taskID] {
+		c.log.Infof("Interrupting cancelled task %s", taskID)
+		w.cancel()
+	}
+}
@@ -0,0 +1,90 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"github.com/redis/go-redis/v9"
+)
+
+// TaskEventsRedis fans task events out over Redis pub/sub, one channel per
+// job, so API instances can stream progress emitted by any worker.
+type TaskEventsRedis struct {
+	rdb *redis.Client
+	log logger.Log
+}
+
+func NewTaskEventsRedis(rdb *redis.Client, log logger.Log) *TaskEventsRedis {
+	return &TaskEventsRedis{
+		rdb: rdb,
+		log: log,
+	}
+}
+
+func jobEventsChannel(jobID string) string {
+	return "jobs:" + jobID + ":events"
+}
+
+func (e *TaskEventsRedis) PublishTaskEvent(ctx context.Context, event domain.TaskEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return e.rdb.Publish(ctx, jobEventsChannel(event.JobID), payload).Err()
+}
+
+func (e *TaskEventsRedis) SubscribeJobEvents(ctx context.Context, jobID string) (domain.TaskEventSubscription, error) {
+	pubsub := e.rdb.Subscribe(ctx, jobEventsChannel(jobID))
+
+	// Wait for the subscription to be confirmed so no event published after
+	// this call returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	sub := &redisTaskEventSubscription{
+		pubsub: pubsub,
+		events: make(chan domain.TaskEvent),
+		done:   make(chan struct{}),
+	}
+	go sub.forward(e.log)
+
+	return sub, nil
+}
+
+type redisTaskEventSubscription struct {
+	pubsub *redis.PubSub
+	events chan domain.TaskEvent
+	done   chan struct{}
+}
+
+func (s *redisTaskEventSubscription) forward(log logger.Log) {
+	defer close(s.events)
+
+	for msg := range s.pubsub.Channel() {
+		var event domain.TaskEvent
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			log.Errorf("Dropping malformed task event on %s: %v", msg.Channel, err)
+			continue
+		}
+
+		select {
+		case s.events <- event:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *redisTaskEventSubscription) Events() <-chan domain.TaskEvent {
+	return s.events
+}
+
+func (s *redisTaskEventSubscription) Close() error {
+	close(s.done)
+	return s.pubsub.Close()
+}
@@ -2,55 +2,583 @@ package infra
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/apperror"
 	"github.com/meraf00/swytch/core/lib/hashids"
 	"github.com/meraf00/swytch/internal/pipeline/domain"
 )
 
 type TaskRepositoryPG struct {
-	db core.Database
-	hs hashids.HashID
+	db        core.Database
+	hs        hashids.HashID
+	taskQueue string
 }
 
-func NewTaskRepositoryPG(db core.Database, hs hashids.HashID) *TaskRepositoryPG {
+func NewTaskRepositoryPG(db core.Database, hs hashids.HashID, taskQueue string) *TaskRepositoryPG {
 	return &TaskRepositoryPG{
-		db: db,
-		hs: hs,
+		db:        db,
+		hs:        hs,
+		taskQueue: taskQueue,
 	}
 }
 
-func (r *TaskRepositoryPG) GetTaskByID(ctx context.Context, taskID string) (*domain.Task, error) {
-	var task *domain.Task
+func (r *TaskRepositoryPG) GetTaskByID(ctx context.Context, ownerID, taskID string) (*domain.Task, error) {
+	taskIDInt, err := r.hs.DecodeID(taskID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	t, err := r.db.Queries().GetTaskByIDAndOwner(ctx, sql.GetTaskByIDAndOwnerParams{
+		ID:      int32(taskIDInt),
+		OwnerID: ownerID,
+	})
+	if err != nil {
+		return nil, notFoundOr(err, errTaskNotFound)
+	}
+
+	return r.taskFromRow(ctx, taskID, sql.GetTaskByIDRow(t))
+}
 
+func (r *TaskRepositoryPG) GetTaskForProcessing(ctx context.Context, taskID string) (*domain.Task, error) {
 	taskIDInt, err := r.hs.DecodeID(taskID)
 	if err != nil {
-		return nil, err
+		return nil, errTaskNotFound
 	}
 
 	t, err := r.db.Queries().GetTaskByID(ctx, int32(taskIDInt))
 	if err != nil {
-		return nil, err
+		return nil, notFoundOr(err, errTaskNotFound)
 	}
 
+	return r.taskFromRow(ctx, taskID, t)
+}
+
+func (r *TaskRepositoryPG) taskFromRow(ctx context.Context, taskID string, t sql.GetTaskByIDRow) (*domain.Task, error) {
+	var task *domain.Task
+
 	fileID, err := r.hs.EncodeID(uint(t.File.ID))
 	if err != nil {
 		return nil, err
 	}
 
+	jobID, err := r.hs.EncodeID(uint(t.JobID.Int32))
+	if err != nil {
+		return nil, err
+	}
+
+	options, err := decodeOptions(t.Options)
+	if err != nil {
+		return nil, err
+	}
+
 	task = &domain.Task{
-		ID:           taskID,
-		TargetFormat: t.TargetFormat,
-		Status:       domain.TaskStatus(t.Status.TaskStatus),
+		ID:                taskID,
+		JobID:             jobID,
+		TargetFormat:      t.TargetFormat,
+		Options:           options,
+		ConvertedFileName: t.ConvertedFileName.String,
+		Status:            domain.TaskStatus(t.Status.TaskStatus),
+		ErrorMessage:      t.ErrorMessage.String,
+		Attempts:          int(t.Attempts),
 		File: domain.File{
 			ID:             fileID,
 			ObjectName:     t.File.ObjectName.String(),
 			OriginalName:   t.File.OriginalName,
 			OriginalFormat: t.File.OriginalFormat,
+			OwnerID:        t.File.OwnerID,
 		},
-		CreatedAt: t.CreatedAt.Time,
-		UpdatedAt: t.UpdatedAt.Time,
+		StartedAt:   t.StartedAt.Time,
+		CompletedAt: t.CompletedAt.Time,
+		CreatedAt:   t.CreatedAt.Time,
+		UpdatedAt:   t.UpdatedAt.Time,
+	}
+
+	inputs, err := r.db.Queries().GetTaskInputs(ctx, t.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, input := range inputs {
+		inputID, err := r.hs.EncodeID(uint(input.File.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		task.Inputs = append(task.Inputs, domain.File{
+			ID:             inputID,
+			ObjectName:     input.File.ObjectName.String(),
+			OriginalName:   input.File.OriginalName,
+			OriginalFormat: input.File.OriginalFormat,
+			OwnerID:        input.File.OwnerID,
+		})
+	}
+
+	return task, nil
+}
+
+// ClaimTask moves a pending task to processing and opens a new attempt. A
+// processing task whose lease ran out is taken over, closing the abandoned
+// attempt as failed. While the lease is held it returns ErrTaskBusy, and
+// ErrTaskFinished once the task reached a final status.
+func (r *TaskRepositoryPG) ClaimTask(ctx context.Context, taskID, workerID string, lease time.Duration) (*domain.Task, error) {
+	task, err := r.GetTaskForProcessing(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	taskIDInt, err := r.hs.DecodeID(taskID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		t, err := q.ClaimTask(ctx, sql.ClaimTaskParams{
+			ID:           int32(taskIDInt),
+			LeaseSeconds: lease.Seconds(),
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			current, err := q.GetTaskByID(ctx, int32(taskIDInt))
+			if err != nil {
+				return notFoundOr(err, errTaskNotFound)
+			}
+			if current.Status.TaskStatus == sql.TaskStatusProcessing {
+				return domain.ErrTaskBusy
+			}
+			return domain.ErrTaskFinished
+		}
+		if err != nil {
+			return err
+		}
+
+		// A taken over attempt is still open
+		if err := finishAttempt(ctx, q, t, sql.TaskStatusFailed, db.ToPGText("worker lease expired")); err != nil {
+			return err
+		}
+
+		task.WorkerID = workerID
+		applyTaskRow(task, t)
+		return startAttempt(ctx, q, task, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (r *TaskRepositoryPG) RenewTaskLease(ctx context.Context, task *domain.Task) error {
+	taskIDInt, err := r.hs.DecodeID(task.ID)
+	if err != nil {
+		return errTaskNotFound
+	}
+
+	renewed, err := r.db.Queries().RenewTaskLease(ctx, sql.RenewTaskLeaseParams{
+		ID:       int32(taskIDInt),
+		Attempts: int32(task.Attempts),
+	})
+	if err != nil {
+		return err
+	}
+	if renewed == 0 {
+		return domain.ErrTaskCancelled
+	}
+	return nil
+}
+
+// UpdateTaskStatus persists the task's progress. Reaching a final state
+// closes the current attempt and queues the task's webhooks in the same
+// transaction.
+func (r *TaskRepositoryPG) UpdateTaskStatus(ctx context.Context, task *domain.Task) (*domain.Task, error) {
+	taskIDInt, err := r.hs.DecodeID(task.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated domain.Task
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		t, err := q.UpdateTaskStatus(ctx, sql.UpdateTaskStatusParams{
+			ID: int32(taskIDInt),
+			Status: sql.NullTaskStatus{
+				TaskStatus: sql.TaskStatus(task.Status),
+				Valid:      true,
+			},
+			StartedAt:         db.ToPGTimestamptz(task.StartedAt),
+			CompletedAt:       db.ToPGTimestamptz(task.CompletedAt),
+			ConvertedFileName: db.ToPGText(task.ConvertedFileName),
+			ErrorMessage:      db.ToPGText(task.ErrorMessage),
+			Attempts:          int32(task.Attempts),
+		})
+		if err != nil {
+			// Only tasks cancelled or taken over are left out of the update
+			return notFoundOr(err, domain.ErrTaskCancelled)
+		}
+
+		updated = *task
+		applyTaskRow(&updated, t)
+
+		if !updated.Status.IsFinal() {
+			return nil
+		}
+		if err := finishAttempt(ctx, q, t, t.Status.TaskStatus, t.ErrorMessage); err != nil {
+			return err
+		}
+		return scheduleTaskWebhooks(ctx, q, r.hs, t.JobID.Int32, t.ID, &updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (r *TaskRepositoryPG) RequeueTask(ctx context.Context, task *domain.Task, reason string) (*domain.Task, error) {
+	taskIDInt, err := r.hs.DecodeID(task.ID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	requeued := *task
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		t, err := q.RequeueTask(ctx, sql.RequeueTaskParams{
+			ID:       int32(taskIDInt),
+			Attempts: int32(task.Attempts),
+		})
+		if err != nil {
+			// Only tasks cancelled or taken over stop processing behind the
+			// worker's back
+			return notFoundOr(err, domain.ErrTaskCancelled)
+		}
+
+		applyTaskRow(&requeued, t)
+		return finishAttempt(ctx, q, t, sql.TaskStatusFailed, db.ToPGText(reason))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &requeued, nil
+}
+
+var errTaskNotCancellable = apperror.BadRequest("task already finished", "task_not_cancellable", nil)
+
+func (r *TaskRepositoryPG) CancelTask(ctx context.Context, ownerID, taskID string) (*domain.Task, error) {
+	task, err := r.GetTaskByID(ctx, ownerID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	taskIDInt, err := r.hs.DecodeID(taskID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		t, err := q.CancelTask(ctx, int32(taskIDInt))
+		if err != nil {
+			return notFoundOr(err, errTaskNotCancellable)
+		}
+
+		applyTaskRow(task, t)
+		if err := finishAttempt(ctx, q, t, t.Status.TaskStatus, t.ErrorMessage); err != nil {
+			return err
+		}
+		return scheduleTaskWebhooks(ctx, q, r.hs, t.JobID.Int32, t.ID, task)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return task, nil
 }
+
+func (r *TaskRepositoryPG) CancelJobTasks(ctx context.Context, ownerID, jobID string) ([]domain.Task, error) {
+	jobIDInt, err := r.hs.DecodeID(jobID)
+	if err != nil {
+		return nil, errJobNotFound
+	}
+
+	var tasks []domain.Task
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		_, err := q.GetJobByID(ctx, sql.GetJobByIDParams{
+			ID:      int32(jobIDInt),
+			OwnerID: ownerID,
+		})
+		if err != nil {
+			return notFoundOr(err, errJobNotFound)
+		}
+
+		rows, err := q.CancelJobTasks(ctx, db.ToPGInt4(int32(jobIDInt)))
+		if err != nil {
+			return err
+		}
+
+		tasks = make([]domain.Task, len(rows))
+		for i, t := range rows {
+			tasks[i].ID, err = r.hs.EncodeID(uint(t.ID))
+			if err != nil {
+				return err
+			}
+			tasks[i].JobID = jobID
+			applyTaskRow(&tasks[i], t)
+
+			if err := finishAttempt(ctx, q, t, t.Status.TaskStatus, t.ErrorMessage); err != nil {
+				return err
+			}
+			if err := scheduleTaskWebhooks(ctx, q, r.hs, t.JobID.Int32, t.ID, &tasks[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+var errTaskNotRetryable = apperror.BadRequest("only failed tasks can be retried", "task_not_retryable", nil)
+
+func (r *TaskRepositoryPG) RetryTask(ctx context.Context, ownerID, taskID string) (*domain.Task, error) {
+	task, err := r.GetTaskByID(ctx, ownerID, taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	taskIDInt, err := r.hs.DecodeID(taskID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		t, err := q.RetryTask(ctx, int32(taskIDInt))
+		if err != nil {
+			return notFoundOr(err, errTaskNotRetryable)
+		}
+
+		applyTaskRow(task, t)
+
+		// The job runs again and announces its final state anew
+		if err := q.BumpJobGeneration(ctx, t.JobID.Int32); err != nil {
+			return err
+		}
+
+		priority, err := q.GetJobPriority(ctx, t.JobID.Int32)
+		if err != nil {
+			return err
+		}
+		return enqueueTask(ctx, q, r.taskQueue, t.ID, task, domain.JobPriority(priority))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (r *TaskRepositoryPG) RetryJobFailedTasks(ctx context.Context, ownerID, jobID string) ([]domain.Task, error) {
+	jobIDInt, err := r.hs.DecodeID(jobID)
+	if err != nil {
+		return nil, errJobNotFound
+	}
+
+	var tasks []domain.Task
+
+	err = r.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		job, err := q.GetJobByID(ctx, sql.GetJobByIDParams{
+			ID:      int32(jobIDInt),
+			OwnerID: ownerID,
+		})
+		if err != nil {
+			return notFoundOr(err, errJobNotFound)
+		}
+
+		rows, err := q.RetryJobFailedTasks(ctx, db.ToPGInt4(int32(jobIDInt)))
+		if err != nil {
+			return err
+		}
+
+		if len(rows) > 0 {
+			if err := q.BumpJobGeneration(ctx, int32(jobIDInt)); err != nil {
+				return err
+			}
+		}
+
+		tasks = make([]domain.Task, len(rows))
+		for i, t := range rows {
+			taskID, err := r.hs.EncodeID(uint(t.ID))
+			if err != nil {
+				return err
+			}
+
+			// Routing needs the task's source files
+			row, err := q.GetTaskByID(ctx, t.ID)
+			if err != nil {
+				return err
+			}
+			task, err := r.taskFromRow(ctx, taskID, row)
+			if err != nil {
+				return err
+			}
+			tasks[i] = *task
+
+			if err := enqueueTask(ctx, q, r.taskQueue, t.ID, task, domain.JobPriority(job.Priority)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+func (r *TaskRepositoryPG) CountPendingTasks(ctx context.Context) (map[domain.JobPriority]int, error) {
+	rows, err := r.db.Queries().CountPendingTasksByPriority(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[domain.JobPriority]int, len(rows))
+	for _, row := range rows {
+		counts[domain.JobPriority(row.Priority)] = int(row.PendingTasks)
+	}
+	return counts, nil
+}
+
+func (r *TaskRepositoryPG) GetTaskAttempts(ctx context.Context, ownerID, taskID string) ([]domain.TaskAttempt, error) {
+	// Check ownership first
+	if _, err := r.GetTaskByID(ctx, ownerID, taskID); err != nil {
+		return nil, err
+	}
+
+	taskIDInt, err := r.hs.DecodeID(taskID)
+	if err != nil {
+		return nil, errTaskNotFound
+	}
+
+	rows, err := r.db.Queries().GetTaskAttempts(ctx, int32(taskIDInt))
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]domain.TaskAttempt, len(rows))
+	for i, a := range rows {
+		attempts[i] = domain.TaskAttempt{
+			Attempt:      int(a.Attempt),
+			WorkerID:     a.WorkerID,
+			Status:       domain.TaskStatus(a.Status),
+			ErrorMessage: a.ErrorMessage.String,
+			StartedAt:    a.StartedAt.Time,
+			CompletedAt:  a.CompletedAt.Time,
+		}
+	}
+
+	return attempts, nil
+}
+
+// applyTaskRow copies the columns of an updated task row onto task.
+func applyTaskRow(task *domain.Task, t sql.Task) {
+	task.Status = domain.TaskStatus(t.Status.TaskStatus)
+	task.TargetFormat = t.TargetFormat
+	task.ConvertedFileName = t.ConvertedFileName.String
+	task.ErrorMessage = t.ErrorMessage.String
+	task.Attempts = int(t.Attempts)
+	task.StartedAt = t.StartedAt.Time
+	task.CompletedAt = t.CompletedAt.Time
+	task.CreatedAt = t.CreatedAt.Time
+	task.UpdatedAt = t.UpdatedAt.Time
+}
+
+// startAttempt counts a new attempt for a task a worker just started.
+func startAttempt(ctx context.Context, q *sql.Queries, task *domain.Task, t sql.Task) error {
+	attempt, err := q.IncrementTaskAttempts(ctx, t.ID)
+	if err != nil {
+		return err
+	}
+	task.Attempts = int(attempt)
+
+	return q.CreateTaskAttempt(ctx, sql.CreateTaskAttemptParams{
+		TaskID:    t.ID,
+		Attempt:   attempt,
+		WorkerID:  task.WorkerID,
+		Status:    sql.TaskStatusProcessing,
+		StartedAt: t.StartedAt,
+	})
+}
+
+// finishAttempt records the outcome of the task's current attempt, if one
+// is still open.
+func finishAttempt(ctx context.Context, q *sql.Queries, t sql.Task, status sql.TaskStatus, errorMessage pgtype.Text) error {
+	return q.FinishTaskAttempt(ctx, sql.FinishTaskAttemptParams{
+		TaskID:       t.ID,
+		Attempt:      t.Attempts,
+		Status:       status,
+		ErrorMessage: errorMessage,
+		CompletedAt:  db.ToPGTimestamptz(time.Now()),
+	})
+}
+
+// enqueueTask queues a task for the workers of its converter class, in the
+// lane of its job's priority, through the outbox, so it is never lost
+// between commit and publish.
+func enqueueTask(ctx context.Context, q *sql.Queries, taskQueue string, taskID int32, task *domain.Task, priority domain.JobPriority) error {
+	payload, err := json.Marshal(domain.TaskMessage{TaskID: task.ID})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateOutboxMessage(ctx, sql.CreateOutboxMessageParams{
+		Queue:    TaskQueue(taskQueue, task.Class(), priority),
+		Payload:  payload,
+		TaskID:   db.ToPGInt4(taskID),
+		Priority: sql.JobPriority(priority),
+	})
+	return err
+}
+
+// TaskQueue names the queue of a converter class and priority lane, e.g.
+// "tasks.image.interactive". The default class and the normal lane add no
+// suffix, so normal tasks of the default class use taskQueue itself.
+func TaskQueue(taskQueue, class string, priority domain.JobPriority) string {
+	queue := taskQueue
+	if class != domain.DefaultConverterClass {
+		queue += "." + class
+	}
+	if priority != domain.JobPriorityNormal {
+		queue += "." + string(priority)
+	}
+	return queue
+}
+
+func encodeOptions(options domain.ConversionOptions) ([]byte, error) {
+	if options == nil {
+		options = domain.ConversionOptions{}
+	}
+	return json.Marshal(options)
+}
+
+func decodeOptions(raw []byte) (domain.ConversionOptions, error) {
+	var options domain.ConversionOptions
+	if len(raw) == 0 {
+		return options, nil
+	}
+
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
@@ -0,0 +1,41 @@
+package infra
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/meraf00/swytch/core"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+type UploadRepositoryPG struct {
+	db core.Database
+}
+
+func NewUploadRepositoryPG(db core.Database) *UploadRepositoryPG {
+	return &UploadRepositoryPG{db: db}
+}
+
+func (r *UploadRepositoryPG) CreateUpload(ctx context.Context, upload *domain.Upload) (*domain.Upload, error) {
+	var objectName pgtype.UUID
+	if err := objectName.Scan(upload.ObjectName); err != nil {
+		return nil, err
+	}
+
+	u, err := r.db.Queries().CreateUpload(ctx, sql.CreateUploadParams{
+		ObjectName:   objectName,
+		OwnerID:      upload.OwnerID,
+		OriginalName: upload.OriginalName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.Upload{
+		ObjectName:   u.ObjectName.String(),
+		OwnerID:      u.OwnerID,
+		OriginalName: u.OriginalName,
+		CreatedAt:    u.CreatedAt.Time,
+	}, nil
+}
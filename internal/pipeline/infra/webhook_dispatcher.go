@@ -0,0 +1,194 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/hashids"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+// WebhookDispatcher posts queued webhook deliveries to their callback URLs.
+// Due deliveries are leased by pushing their next attempt past the request
+// timeout, so several dispatchers can run side by side and a delivery
+// abandoned by a crashed dispatcher is picked up again once the lease ends.
+type WebhookDispatcher struct {
+	db     core.Database
+	hs     hashids.HashID
+	client *http.Client
+	log    logger.Log
+	cfg    core.WebhookConfig
+}
+
+func NewWebhookDispatcher(db core.Database, hs hashids.HashID, cfg core.WebhookConfig, log logger.Log) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		db:     db,
+		hs:     hs,
+		client: newWebhookClient(cfg.Timeout, cfg.AllowPrivateNetworks),
+		log:    log.Named("webhook-dispatcher"),
+		cfg:    cfg,
+	}
+}
+
+// Run polls for due deliveries until ctx is cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := d.dispatchBatch(ctx)
+		if err != nil {
+			d.log.Errorf("Failed to dispatch webhooks: %v", err)
+		}
+
+		if err == nil && claimed == d.cfg.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatchBatch(ctx context.Context) (int, error) {
+	deliveries, err := d.db.Queries().ClaimDueWebhookDeliveries(ctx, sql.ClaimDueWebhookDeliveriesParams{
+		LeaseUntil: db.ToPGTimestamptz(time.Now().Add(2 * d.cfg.Timeout)),
+		BatchSize:  int32(d.cfg.BatchSize),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.deliver(ctx, delivery); err != nil {
+				d.log.Errorf("Failed to record webhook delivery %d: %v", delivery.ID, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// deliver makes one attempt and records its outcome, scheduling a retry
+// with exponential backoff until the attempts run out.
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery sql.ClaimDueWebhookDeliveriesRow) error {
+	attempt := delivery.Attempts + 1
+
+	start := time.Now()
+	statusCode, sendErr := d.post(ctx, delivery)
+	duration := time.Since(start)
+
+	if ctx.Err() != nil {
+		// Shutting down; the lease expires and the attempt is retried
+		return nil
+	}
+
+	update := sql.UpdateWebhookDeliveryParams{
+		ID:            delivery.ID,
+		Status:        sql.WebhookStatusDelivered,
+		Attempts:      attempt,
+		NextAttemptAt: db.ToPGTimestamptz(time.Now()),
+	}
+
+	var lastError string
+	switch {
+	case sendErr != nil:
+		lastError = sendErr.Error()
+		update.LastError = db.ToPGText(lastError)
+		if int(attempt) >= d.cfg.MaxAttempts {
+			update.Status = sql.WebhookStatusFailed
+		} else {
+			update.Status = sql.WebhookStatusPending
+			update.NextAttemptAt = db.ToPGTimestamptz(time.Now().Add(d.backoff(int(attempt))))
+		}
+	default:
+		update.DeliveredAt = db.ToPGTimestamptz(time.Now())
+	}
+
+	return d.db.WithTransaction(ctx, func(q *sql.Queries) error {
+		err := q.CreateWebhookAttempt(ctx, sql.CreateWebhookAttemptParams{
+			DeliveryID: delivery.ID,
+			Attempt:    attempt,
+			StatusCode: toPGStatusCode(statusCode),
+			Error:      db.ToPGText(lastError),
+			DurationMs: int32(duration.Milliseconds()),
+		})
+		if err != nil {
+			return err
+		}
+
+		return q.UpdateWebhookDelivery(ctx, update)
+	})
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, delivery sql.ClaimDueWebhookDeliveriesRow) (int, error) {
+	deliveryID, err := d.hs.EncodeID(uint(delivery.ID))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.CallbackUrl.String, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "swytch-webhooks")
+	req.Header.Set("X-Swytch-Event", delivery.Event)
+	req.Header.Set("X-Swytch-Delivery", deliveryID)
+	req.Header.Set("X-Swytch-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set("X-Swytch-Signature", "sha256="+domain.SignWebhook(delivery.CallbackSecret.String, now, delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a bounded amount so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("callback responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, nil
+}
+
+func (d *WebhookDispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.BackoffBase
+	for i := 1; i < attempt && delay < d.cfg.BackoffMax; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.BackoffMax)
+}
+
+func toPGStatusCode(code int) pgtype.Int4 {
+	if code == 0 {
+		return pgtype.Int4{}
+	}
+	return db.ToPGInt4(int32(code))
+}
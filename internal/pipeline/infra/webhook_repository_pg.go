@@ -0,0 +1,170 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/db"
+	sql "github.com/meraf00/swytch/core/db/sqlc"
+	"github.com/meraf00/swytch/core/lib/hashids"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+type WebhookRepositoryPG struct {
+	db core.Database
+	hs hashids.HashID
+}
+
+func NewWebhookRepositoryPG(db core.Database, hs hashids.HashID) *WebhookRepositoryPG {
+	return &WebhookRepositoryPG{
+		db: db,
+		hs: hs,
+	}
+}
+
+func (r *WebhookRepositoryPG) GetJobWebhookDeliveries(ctx context.Context, jobID string) ([]domain.WebhookDelivery, error) {
+	jobIDInt, err := r.hs.DecodeID(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.Queries().GetWebhookDeliveriesByJobID(ctx, int32(jobIDInt))
+	if err != nil {
+		return nil, err
+	}
+
+	attempts, err := r.db.Queries().GetWebhookAttemptsByJobID(ctx, int32(jobIDInt))
+	if err != nil {
+		return nil, err
+	}
+
+	attemptsByDelivery := make(map[int64][]domain.WebhookAttempt)
+	for _, a := range attempts {
+		attemptsByDelivery[a.DeliveryID] = append(attemptsByDelivery[a.DeliveryID], domain.WebhookAttempt{
+			Attempt:    int(a.Attempt),
+			StatusCode: int(a.StatusCode.Int32),
+			Error:      a.Error.String,
+			Duration:   time.Duration(a.DurationMs) * time.Millisecond,
+			CreatedAt:  a.CreatedAt.Time,
+		})
+	}
+
+	deliveries := make([]domain.WebhookDelivery, len(rows))
+	for i, d := range rows {
+		id, err := r.hs.EncodeID(uint(d.ID))
+		if err != nil {
+			return nil, err
+		}
+
+		var taskID string
+		if d.TaskID.Valid {
+			taskID, err = r.hs.EncodeID(uint(d.TaskID.Int32))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		deliveries[i] = domain.WebhookDelivery{
+			ID:            id,
+			JobID:         jobID,
+			TaskID:        taskID,
+			Event:         domain.WebhookEvent(d.Event),
+			Status:        domain.WebhookStatus(d.Status),
+			Attempts:      attemptsByDelivery[d.ID],
+			NextAttemptAt: d.NextAttemptAt.Time,
+			LastError:     d.LastError.String,
+			DeliveredAt:   d.DeliveredAt.Time,
+			CreatedAt:     d.CreatedAt.Time,
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (r *WebhookRepositoryPG) GetOrCreateWebhookSecret(ctx context.Context, ownerID, secret string) (string, error) {
+	s, err := r.db.Queries().GetOrCreateWebhookSecret(ctx, sql.GetOrCreateWebhookSecretParams{
+		OwnerID: ownerID,
+		Secret:  secret,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.Secret, nil
+}
+
+func (r *WebhookRepositoryPG) RotateWebhookSecret(ctx context.Context, ownerID, secret string) (string, error) {
+	s, err := r.db.Queries().RotateWebhookSecret(ctx, sql.RotateWebhookSecretParams{
+		OwnerID: ownerID,
+		Secret:  secret,
+	})
+	if err != nil {
+		return "", err
+	}
+	return s.Secret, nil
+}
+
+// scheduleTaskWebhooks queues the webhook for a task that reached a final
+// state and, when it was the last one running, the webhook for its job.
+// The job row is locked so that of two tasks finishing together, the one
+// committing last sees both final; the unique job event index drops any
+// duplicate within the job's generation, which retries bump.
+func scheduleTaskWebhooks(ctx context.Context, q *sql.Queries, hs hashids.HashID, jobID, taskID int32, task *domain.Task) error {
+	job, err := q.GetJobByIDForUpdate(ctx, jobID)
+	if err != nil {
+		return err
+	}
+
+	if !job.CallbackUrl.Valid {
+		return nil
+	}
+
+	taskWebhook := domain.NewTaskWebhook(task)
+	payload, err := json.Marshal(taskWebhook)
+	if err != nil {
+		return err
+	}
+
+	err = q.CreateWebhookDelivery(ctx, sql.CreateWebhookDeliveryParams{
+		JobID:      jobID,
+		TaskID:     db.ToPGInt4(taskID),
+		Event:      string(taskWebhook.Event),
+		Payload:    payload,
+		Generation: job.Generation,
+	})
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.GetTasksByJobID(ctx, db.ToPGInt4(jobID))
+	if err != nil {
+		return err
+	}
+
+	tasks := make([]domain.Task, len(rows))
+	for i, row := range rows {
+		t, err := jobTaskFromRow(hs, task.JobID, row)
+		if err != nil {
+			return err
+		}
+		tasks[i] = *t
+	}
+
+	jobWebhook, done := domain.NewJobWebhook(task.JobID, tasks)
+	if !done {
+		return nil
+	}
+
+	payload, err = json.Marshal(jobWebhook)
+	if err != nil {
+		return err
+	}
+
+	return q.CreateWebhookDelivery(ctx, sql.CreateWebhookDeliveryParams{
+		JobID:      jobID,
+		Event:      string(jobWebhook.Event),
+		Payload:    payload,
+		Generation: job.Generation,
+	})
+}
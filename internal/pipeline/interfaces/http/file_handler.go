@@ -9,13 +9,14 @@ import (
 )
 
 // Generate pre-signed upload url
-func HandleGetUploadPresignedURL(fs app.FileService) http.HandlerFunc {
+func HandleGetUploadPresignedURL(cs *app.PipelineService) http.HandlerFunc {
 	type uploadRequest struct {
 		Filename string `json:"filename" validate:"required"`
 	}
 
 	type uploadResponse struct {
-		UploadURL string `json:"upload_url"`
+		UploadURL  string `json:"upload_url"`
+		ObjectName string `json:"object_name"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -33,13 +34,15 @@ func HandleGetUploadPresignedURL(fs app.FileService) http.HandlerFunc {
 
 		req := body.(*uploadRequest)
 
-		url, err := fs.GenerateUploadUrl(ctx, req.Filename)
+		upload, url, err := cs.CreateUpload(ctx, req.Filename)
 		if err != nil {
 			respond.Error(w, err)
+			return
 		}
 
 		respond.SuccessWithData(w, http.StatusOK, &uploadResponse{
-			UploadURL: url.String(),
+			UploadURL:  url.String(),
+			ObjectName: upload.ObjectName,
 		})
 	}
 }
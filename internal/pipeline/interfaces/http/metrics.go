@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/meraf00/swytch/internal/pipeline/app"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+// queueDepthTTL bounds how often scrapes reach the database.
+const queueDepthTTL = 15 * time.Second
+
+// QueueDepthMetric reports the pending tasks of each priority lane for
+// expvar. Counts are cached for queueDepthTTL.
+func QueueDepthMetric(cs *app.PipelineService) expvar.Func {
+	var (
+		mu        sync.Mutex
+		cached    any
+		refreshed time.Time
+	)
+
+	return func() any {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if cached != nil && time.Since(refreshed) < queueDepthTTL {
+			return cached
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		depths, err := cs.QueueDepths(ctx)
+		if err != nil {
+			// Errors are not cached so the next scrape retries
+			return map[string]string{"error": err.Error()}
+		}
+
+		res := make(map[string]int, len(depths))
+		for _, priority := range domain.JobPriorities() {
+			res[string(priority)] = depths[priority]
+		}
+
+		cached, refreshed = res, time.Now()
+		return cached
+	}
+}
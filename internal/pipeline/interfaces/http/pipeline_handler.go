@@ -1,26 +1,66 @@
 package handler
 
 import (
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/meraf00/swytch/core/lib/middleware"
 	"github.com/meraf00/swytch/core/lib/respond"
 	"github.com/meraf00/swytch/core/lib/validation"
 	"github.com/meraf00/swytch/internal/pipeline/app"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
 )
 
-// Get job by ID
+// jobSummary is how jobs are described in responses: their aggregate
+// status and progress, without the individual tasks.
+type jobSummary struct {
+	JobID      string         `json:"job_id"`
+	Status     string         `json:"status"`
+	Priority   string         `json:"priority"`
+	Tasks      map[string]int `json:"tasks"`
+	Progress   float64        `json:"progress"`
+	StartedAt  *time.Time     `json:"started_at,omitempty"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+func toJobSummary(job *domain.Job) jobSummary {
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+
+	return jobSummary{
+		JobID:    job.ID,
+		Status:   string(job.Status),
+		Priority: string(job.Priority),
+		Tasks: map[string]int{
+			"total":                         job.TaskCounts.Total,
+			string(domain.StatusPending):    job.TaskCounts.Pending,
+			string(domain.StatusProcessing): job.TaskCounts.Processing,
+			string(domain.StatusCompleted):  job.TaskCounts.Completed,
+			string(domain.StatusFailed):     job.TaskCounts.Failed,
+			string(domain.StatusCancelled):  job.TaskCounts.Cancelled,
+		},
+		Progress:   math.Round(job.TaskCounts.Progress()*10) / 10,
+		StartedAt:  optional(job.StartedAt),
+		FinishedAt: optional(job.FinishedAt),
+		CreatedAt:  job.CreatedAt,
+		UpdatedAt:  job.UpdatedAt,
+	}
+}
+
+// Get job by ID with its aggregate status and progress
 func HandleGetJob(cs *app.PipelineService) http.HandlerFunc {
 	type getJobRequest struct {
 		ID string `json:"job_id" validate:"required"`
 	}
 
-	type response struct {
-		JobID     string    `json:"job_id"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := r.Context()
 		validator := validation.NewValidator(validation.ValidationSchemas{
@@ -42,11 +82,73 @@ func HandleGetJob(cs *app.PipelineService) http.HandlerFunc {
 			return
 		}
 
-		respond.JSON(w, http.StatusOK, &response{
-			JobID:     job.ID,
-			CreatedAt: job.CreatedAt,
-			UpdatedAt: job.UpdatedAt,
+		respond.JSON(w, http.StatusOK, toJobSummary(job))
+	}
+}
+
+// List the caller's jobs, newest first by default. Pass next_cursor back
+// as cursor to fetch the following page.
+func HandleListJobs(cs *app.PipelineService) http.HandlerFunc {
+	type listJobsRequest struct {
+		Status        string `json:"status" validate:"omitempty,oneof=pending running completed failed partially_failed cancelled"`
+		CreatedAfter  string `json:"created_after" validate:"omitempty,rfc3339"`
+		CreatedBefore string `json:"created_before" validate:"omitempty,rfc3339"`
+		FileName      string `json:"file_name" validate:"max=255"`
+		Sort          string `json:"sort" validate:"omitempty,oneof=created_at -created_at"`
+		Cursor        string `json:"cursor"`
+		Limit         string `json:"limit" validate:"omitempty,number"`
+	}
+
+	type response struct {
+		Jobs       []jobSummary `json:"jobs"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Query: &listJobsRequest{},
 		})
+
+		query, err := validator.GetQuery(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := query.(*listJobsRequest)
+
+		filter := &domain.JobFilter{
+			Status:      domain.JobStatus(req.Status),
+			FileName:    req.FileName,
+			OldestFirst: req.Sort == "created_at",
+			Cursor:      req.Cursor,
+		}
+		if req.CreatedAfter != "" {
+			filter.CreatedAfter, _ = validation.ParseTime(req.CreatedAfter)
+		}
+		if req.CreatedBefore != "" {
+			filter.CreatedBefore, _ = validation.ParseTime(req.CreatedBefore)
+		}
+		if req.Limit != "" {
+			filter.Limit, _ = strconv.Atoi(req.Limit)
+		}
+
+		page, err := cs.ListJobs(ctx, filter)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := &response{
+			Jobs:       make([]jobSummary, len(page.Jobs)),
+			NextCursor: page.NextCursor,
+		}
+		for i := range page.Jobs {
+			res.Jobs[i] = toJobSummary(&page.Jobs[i])
+		}
+
+		respond.JSON(w, http.StatusOK, res)
 	}
 }
 
@@ -66,6 +168,8 @@ func HandleGetJobTasks(cs *app.PipelineService) http.HandlerFunc {
 		OriginalFormat    string    `json:"original_format"`
 		TargetFormat      string    `json:"target_format"`
 		ConvertedFileName string    `json:"converted_file_name,omitempty"`
+		ErrorMessage      string    `json:"error_message,omitempty"`
+		Attempts          int       `json:"attempts"`
 	}
 
 	type response struct {
@@ -106,6 +210,8 @@ func HandleGetJobTasks(cs *app.PipelineService) http.HandlerFunc {
 				OriginalFormat:    task.File.OriginalFormat,
 				TargetFormat:      task.TargetFormat,
 				ConvertedFileName: task.ConvertedFileName,
+				ErrorMessage:      task.ErrorMessage,
+				Attempts:          task.Attempts,
 			}
 		}
 
@@ -115,15 +221,243 @@ func HandleGetJobTasks(cs *app.PipelineService) http.HandlerFunc {
 	}
 }
 
-// Create a new conversion job with related tasks and files
+// Stream task status transitions of a job as Server-Sent Events. Every task
+// is sent once on connect, then again on each change; a final "done" event
+// is sent when all tasks have finished.
+func HandleGetJobStatus(cs *app.PipelineService) http.HandlerFunc {
+	const pingInterval = 15 * time.Second
+
+	type getJobRequest struct {
+		ID string `json:"job_id" validate:"required"`
+	}
+
+	type taskEvent struct {
+		TaskID            string    `json:"task_id"`
+		Status            string    `json:"status"`
+		ConvertedFileName string    `json:"converted_file_name,omitempty"`
+		ErrorMessage      string    `json:"error_message,omitempty"`
+		UpdatedAt         time.Time `json:"updated_at"`
+	}
+
+	type doneEvent struct {
+		JobID string `json:"job_id"`
+	}
+
+	toTaskEvent := func(event domain.TaskEvent) *taskEvent {
+		return &taskEvent{
+			TaskID:            event.TaskID,
+			Status:            string(event.Status),
+			ConvertedFileName: event.ConvertedFileName,
+			ErrorMessage:      event.ErrorMessage,
+			UpdatedAt:         event.UpdatedAt,
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := middleware.StreamContext(r)
+		defer cancel()
+
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &getJobRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*getJobRequest)
+
+		tasks, sub, err := cs.WatchJob(ctx, req.ID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+		defer sub.Close()
+
+		stream, err := respond.SSE(w)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		pending := make(map[string]bool)
+		for _, task := range tasks {
+			if err := stream.Send("task", toTaskEvent(domain.NewTaskEvent(&task))); err != nil {
+				return
+			}
+			if !task.Status.IsFinal() {
+				pending[task.ID] = true
+			}
+		}
+
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for len(pending) > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				if err := stream.Send("task", toTaskEvent(event)); err != nil {
+					return
+				}
+				if event.Status.IsFinal() {
+					delete(pending, event.TaskID)
+				}
+			case <-ticker.C:
+				if err := stream.Ping(); err != nil {
+					return
+				}
+			}
+		}
+
+		stream.Send("done", &doneEvent{JobID: req.ID})
+	}
+}
+
+// List webhook deliveries of a job with every attempt made
+func HandleGetJobWebhooks(cs *app.PipelineService) http.HandlerFunc {
+	type getJobRequest struct {
+		ID string `json:"job_id" validate:"required"`
+	}
+
+	type responseAttempt struct {
+		Attempt    int       `json:"attempt"`
+		StatusCode int       `json:"status_code,omitempty"`
+		Error      string    `json:"error,omitempty"`
+		DurationMs int64     `json:"duration_ms"`
+		CreatedAt  time.Time `json:"created_at"`
+	}
+
+	type responseDelivery struct {
+		ID            string            `json:"id"`
+		TaskID        string            `json:"task_id,omitempty"`
+		Event         string            `json:"event"`
+		Status        string            `json:"status"`
+		Attempts      []responseAttempt `json:"attempts"`
+		NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+		LastError     string            `json:"last_error,omitempty"`
+		DeliveredAt   *time.Time        `json:"delivered_at,omitempty"`
+		CreatedAt     time.Time         `json:"created_at"`
+	}
+
+	type response struct {
+		Deliveries []responseDelivery `json:"deliveries"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &getJobRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*getJobRequest)
+
+		deliveries, err := cs.GetJobWebhookDeliveries(ctx, req.ID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := make([]responseDelivery, len(deliveries))
+		for i, d := range deliveries {
+			attempts := make([]responseAttempt, len(d.Attempts))
+			for k, a := range d.Attempts {
+				attempts[k] = responseAttempt{
+					Attempt:    a.Attempt,
+					StatusCode: a.StatusCode,
+					Error:      a.Error,
+					DurationMs: a.Duration.Milliseconds(),
+					CreatedAt:  a.CreatedAt,
+				}
+			}
+
+			res[i] = responseDelivery{
+				ID:        d.ID,
+				TaskID:    d.TaskID,
+				Event:     string(d.Event),
+				Status:    string(d.Status),
+				Attempts:  attempts,
+				LastError: d.LastError,
+				CreatedAt: d.CreatedAt,
+			}
+			if d.Status == domain.WebhookPending {
+				res[i].NextAttemptAt = &d.NextAttemptAt
+			}
+			if !d.DeliveredAt.IsZero() {
+				res[i].DeliveredAt = &d.DeliveredAt
+			}
+		}
+
+		respond.JSON(w, http.StatusOK, &response{
+			Deliveries: res,
+		})
+	}
+}
+
+// Get the secret the caller's webhooks are signed with
+func HandleGetWebhookSecret(cs *app.PipelineService) http.HandlerFunc {
+	type response struct {
+		Secret string `json:"secret"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, err := cs.WebhookSecret(r.Context())
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, &response{Secret: secret})
+	}
+}
+
+// Replace the caller's webhook secret
+func HandleRotateWebhookSecret(cs *app.PipelineService) http.HandlerFunc {
+	type response struct {
+		Secret string `json:"secret"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret, err := cs.RotateWebhookSecret(r.Context())
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, &response{Secret: secret})
+	}
+}
+
+// Create a new conversion job with related tasks and files. When merge is
+// set, every file requesting the merge target format is combined into a
+// single output instead of one output per file.
 func HandleCreateJob(cs *app.PipelineService) http.HandlerFunc {
 	type createJobRequest struct {
 		Files []struct {
-			ObjectName     string   `json:"object_name"`
-			OriginalName   string   `json:"original_name"`
-			OriginalFormat string   `json:"original_format"`
-			TargetFormats  []string `json:"target_formats"`
+			ObjectName     string            `json:"object_name"`
+			OriginalName   string            `json:"original_name"`
+			OriginalFormat string            `json:"original_format"`
+			TargetFormats  []string          `json:"target_formats"`
+			Options        map[string]string `json:"options"`
 		} `json:"files"`
+		Merge *struct {
+			TargetFormat string            `json:"target_format" validate:"required"`
+			Options      map[string]string `json:"options"`
+		} `json:"merge"`
+		CallbackURL string `json:"callback_url" validate:"omitempty,http_url"`
+		Priority    string `json:"priority" validate:"omitempty,oneof=interactive normal bulk"`
 	}
 
 	type response struct {
@@ -145,14 +479,26 @@ func HandleCreateJob(cs *app.PipelineService) http.HandlerFunc {
 
 		req := body.(*createJobRequest)
 
-		jobID, err := cs.CreateJob(ctx, &app.CreateJobParams{
+		params := &app.CreateJobParams{
 			Files: []struct {
 				ObjectName     string
 				OriginalName   string
 				OriginalFormat string
 				TargetFormats  []string
+				Options        map[string]string
 			}(req.Files),
-		})
+			CallbackURL: req.CallbackURL,
+			Priority:    domain.JobPriority(req.Priority),
+		}
+
+		if req.Merge != nil {
+			params.Merge = &app.MergeParams{
+				TargetFormat: req.Merge.TargetFormat,
+				Options:      req.Merge.Options,
+			}
+		}
+
+		job, err := cs.CreateJob(ctx, params)
 
 		if err != nil {
 			respond.Error(w, err)
@@ -160,8 +506,8 @@ func HandleCreateJob(cs *app.PipelineService) http.HandlerFunc {
 		}
 
 		respond.JSON(w, http.StatusOK, &response{
-			JobID:       jobID,
-			ProgressURL: "/jobs/" + jobID + "/status",
+			JobID:       job.ID,
+			ProgressURL: "/api/jobs/" + job.ID + "/status",
 		})
 	}
 }
@@ -201,3 +547,265 @@ func HandleGetCompletedTaskDownloadURL(cs *app.PipelineService) http.HandlerFunc
 		})
 	}
 }
+
+// List conversions supported by this build
+func HandleGetSupportedConversions(cs *app.PipelineService) http.HandlerFunc {
+	type response struct {
+		Conversions map[string][]string `json:"conversions"`
+		Merges      map[string][]string `json:"merges"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		respond.JSON(w, http.StatusOK, &response{
+			Conversions: cs.GetSupportedConversions(),
+			Merges:      cs.GetSupportedMerges(),
+		})
+	}
+}
+
+// Cancel every unfinished task of a job
+func HandleCancelJob(cs *app.PipelineService) http.HandlerFunc {
+	type cancelJobRequest struct {
+		ID string `json:"job_id" validate:"required"`
+	}
+
+	type responseTask struct {
+		TaskID string `json:"task_id"`
+		Status string `json:"status"`
+	}
+
+	type response struct {
+		JobID          string         `json:"job_id"`
+		CancelledTasks []responseTask `json:"cancelled_tasks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &cancelJobRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*cancelJobRequest)
+
+		tasks, err := cs.CancelJob(ctx, req.ID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := &response{
+			JobID:          req.ID,
+			CancelledTasks: make([]responseTask, len(tasks)),
+		}
+		for i, task := range tasks {
+			res.CancelledTasks[i] = responseTask{
+				TaskID: task.ID,
+				Status: string(task.Status),
+			}
+		}
+
+		respond.JSON(w, http.StatusOK, res)
+	}
+}
+
+// Cancel a pending or processing task
+func HandleCancelTask(cs *app.PipelineService) http.HandlerFunc {
+	type cancelTaskRequest struct {
+		TaskID string `json:"task_id" validate:"required"`
+	}
+
+	type response struct {
+		TaskID string `json:"task_id"`
+		JobID  string `json:"job_id"`
+		Status string `json:"status"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &cancelTaskRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*cancelTaskRequest)
+
+		task, err := cs.CancelTask(ctx, req.TaskID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, &response{
+			TaskID: task.ID,
+			JobID:  task.JobID,
+			Status: string(task.Status),
+		})
+	}
+}
+
+// Queue every failed task of a job again
+func HandleRetryFailedTasks(cs *app.PipelineService) http.HandlerFunc {
+	type retryJobRequest struct {
+		ID string `json:"job_id" validate:"required"`
+	}
+
+	type responseTask struct {
+		TaskID   string `json:"task_id"`
+		Status   string `json:"status"`
+		Attempts int    `json:"attempts"`
+	}
+
+	type response struct {
+		JobID        string         `json:"job_id"`
+		RetriedTasks []responseTask `json:"retried_tasks"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &retryJobRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*retryJobRequest)
+
+		tasks, err := cs.RetryFailedTasks(ctx, req.ID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := &response{
+			JobID:        req.ID,
+			RetriedTasks: make([]responseTask, len(tasks)),
+		}
+		for i, task := range tasks {
+			res.RetriedTasks[i] = responseTask{
+				TaskID:   task.ID,
+				Status:   string(task.Status),
+				Attempts: task.Attempts,
+			}
+		}
+
+		respond.JSON(w, http.StatusOK, res)
+	}
+}
+
+// Queue a failed task again
+func HandleRetryTask(cs *app.PipelineService) http.HandlerFunc {
+	type retryTaskRequest struct {
+		TaskID string `json:"task_id" validate:"required"`
+	}
+
+	type response struct {
+		TaskID   string `json:"task_id"`
+		JobID    string `json:"job_id"`
+		Status   string `json:"status"`
+		Attempts int    `json:"attempts"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &retryTaskRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*retryTaskRequest)
+
+		task, err := cs.RetryTask(ctx, req.TaskID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		respond.JSON(w, http.StatusOK, &response{
+			TaskID:   task.ID,
+			JobID:    task.JobID,
+			Status:   string(task.Status),
+			Attempts: task.Attempts,
+		})
+	}
+}
+
+// List every attempt made at a task, oldest first
+func HandleGetTaskAttempts(cs *app.PipelineService) http.HandlerFunc {
+	type getAttemptsRequest struct {
+		TaskID string `json:"task_id" validate:"required"`
+	}
+
+	type responseAttempt struct {
+		Attempt      int        `json:"attempt"`
+		WorkerID     string     `json:"worker_id"`
+		Status       string     `json:"status"`
+		ErrorMessage string     `json:"error_message,omitempty"`
+		StartedAt    time.Time  `json:"started_at"`
+		CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	}
+
+	type response struct {
+		TaskID   string            `json:"task_id"`
+		Attempts []responseAttempt `json:"attempts"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		validator := validation.NewValidator(validation.ValidationSchemas{
+			Params: &getAttemptsRequest{},
+		})
+
+		body, err := validator.GetParams(r)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		req := body.(*getAttemptsRequest)
+
+		attempts, err := cs.GetTaskAttempts(ctx, req.TaskID)
+		if err != nil {
+			respond.Error(w, err)
+			return
+		}
+
+		res := &response{
+			TaskID:   req.TaskID,
+			Attempts: make([]responseAttempt, len(attempts)),
+		}
+		for i, a := range attempts {
+			res.Attempts[i] = responseAttempt{
+				Attempt:      a.Attempt,
+				WorkerID:     a.WorkerID,
+				Status:       string(a.Status),
+				ErrorMessage: a.ErrorMessage,
+				StartedAt:    a.StartedAt,
+			}
+			if !a.CompletedAt.IsZero() {
+				res.Attempts[i].CompletedAt = &a.CompletedAt
+			}
+		}
+
+		respond.JSON(w, http.StatusOK, res)
+	}
+}
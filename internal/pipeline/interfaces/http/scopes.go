@@ -0,0 +1,12 @@
+package handler
+
+// Scopes a caller's credentials must grant to use the pipeline routes.
+// JWTs without a scope claim are granted JWT_DEFAULT_SCOPES, all of them
+// unless configured otherwise.
+const (
+	ScopeFilesRead      = "files:read"
+	ScopeFilesWrite     = "files:write"
+	ScopeJobsRead       = "jobs:read"
+	ScopeJobsWrite      = "jobs:write"
+	ScopeWebhooksManage = "webhooks:manage"
+)
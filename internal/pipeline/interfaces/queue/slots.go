@@ -0,0 +1,70 @@
+package consumer
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// slots bounds how many tasks a worker processes at once across all of its
+// queues. Freed slots go to waiting handlers of the lowest rank first.
+type slots struct {
+	mu      sync.Mutex
+	free    int
+	waiting [][]chan struct{}
+}
+
+func newSlots(n, ranks int) *slots {
+	return &slots{
+		free:    n,
+		waiting: make([][]chan struct{}, ranks),
+	}
+}
+
+// acquire waits for a slot until ctx is done.
+func (s *slots) acquire(ctx context.Context, rank int) error {
+	s.mu.Lock()
+	if s.free > 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	granted := make(chan struct{})
+	s.waiting[rank] = append(s.waiting[rank], granted)
+	s.mu.Unlock()
+
+	select {
+	case <-granted:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.Index(s.waiting[rank], granted); i >= 0 {
+		s.waiting[rank] = slices.Delete(s.waiting[rank], i, i+1)
+		return ctx.Err()
+	}
+	// Granted while giving up; pass it on
+	s.releaseLocked()
+	return ctx.Err()
+}
+
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseLocked()
+}
+
+func (s *slots) releaseLocked() {
+	for rank, waiting := range s.waiting {
+		if len(waiting) > 0 {
+			close(waiting[0])
+			s.waiting[rank] = waiting[1:]
+			return
+		}
+	}
+	s.free++
+}
@@ -0,0 +1,135 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/app"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+)
+
+// TaskQueue is a queue a worker takes tasks from. When the worker is busy,
+// waiting tasks of the lowest Rank start first.
+type TaskQueue struct {
+	Name string
+	Rank int
+}
+
+type TaskConsumer struct {
+	broker broker.Broker
+	queues []TaskQueue
+	opts   broker.SubscribeOptions
+	slots  *slots
+	worker *app.WorkerService
+	log    logger.Log
+}
+
+// NewTaskConsumer consumes queues with opts.Concurrency tasks in progress at
+// most across all of them. Each queue holds up to opts.Prefetch messages,
+// so a queue that has work can use every free slot.
+func NewTaskConsumer(mq broker.Broker, queues []TaskQueue, opts broker.SubscribeOptions, worker *app.WorkerService, log logger.Log) *TaskConsumer {
+	opts = opts.WithDefaults()
+
+	ranks := 0
+	for _, queue := range queues {
+		ranks = max(ranks, queue.Rank+1)
+	}
+
+	return &TaskConsumer{
+		broker: mq,
+		queues: queues,
+		opts:   opts,
+		slots:  newSlots(opts.Concurrency, ranks),
+		worker: worker,
+		log:    log.Named("task-consumer"),
+	}
+}
+
+// Run consumes task messages until ctx is cancelled or the broker is
+// closed. Closing the broker lets tasks in progress finish first.
+func (c *TaskConsumer) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, queue := range c.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.consume(ctx, queue)
+		}()
+	}
+	wg.Wait()
+}
+
+func (c *TaskConsumer) consume(ctx context.Context, queue TaskQueue) {
+	c.log.Infof("Consuming tasks from %s", queue.Name)
+
+	handler := func(ctx context.Context, d broker.Delivery) {
+		for {
+			// Unsettled deliveries are redelivered once the subscription ends
+			if err := c.slots.acquire(ctx, queue.Rank); err != nil {
+				return
+			}
+			busy := c.handle(ctx, d)
+			c.slots.release()
+
+			// The delivery is held until the other worker's lease may have
+			// run out rather than nacked, which would use up a retry
+			if !busy || !wait(ctx, c.worker.Lease()) {
+				return
+			}
+		}
+	}
+
+	err := c.broker.Subscribe(ctx, queue.Name, handler, c.opts)
+	if err != nil && !errors.Is(err, broker.ErrClosed) {
+		c.log.Errorf("Stopped consuming tasks from %s: %v", queue.Name, err)
+	}
+}
+
+// handle processes the task of d and settles d, unless another worker holds
+// the task's lease. It then reports busy and leaves d unsettled.
+func (c *TaskConsumer) handle(ctx context.Context, d broker.Delivery) (busy bool) {
+	var msg domain.TaskMessage
+	if err := json.Unmarshal(d.Body, &msg); err != nil || msg.TaskID == "" {
+		c.log.Errorf("Discarding malformed task message: %s", string(d.Body))
+		d.Nack(false)
+		return false
+	}
+
+	log := c.log.WithFields(map[string]any{"taskID": msg.TaskID})
+	log.Info("Processing task")
+
+	err := c.worker.ProcessTask(ctx, msg.TaskID, d.CanRetry())
+	if errors.Is(err, domain.ErrTaskBusy) {
+		log.Info("Task is held by another worker, trying again once its lease runs out")
+		return true
+	}
+	if err != nil {
+		log.Errorf("Failed to process task (attempt %d): %v", d.Attempts+1, err)
+		if err := d.Nack(true); err != nil {
+			log.Errorf("Failed to schedule retry: %v", err)
+		}
+		return false
+	}
+
+	log.Info("Task processed")
+	d.Ack()
+	return false
+}
+
+// wait sleeps for d and reports whether ctx is still live.
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
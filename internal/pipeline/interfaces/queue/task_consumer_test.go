@@ -0,0 +1,482 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/broker/memory"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/app"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	_ "github.com/meraf00/swytch/internal/pipeline/infra/converter/raster"
+)
+
+const testQueue = "tasks"
+
+func TestPipelineCompletesJob(t *testing.T) {
+	p := newPipeline(t, 2, time.Minute)
+	p.files.put("photo.png", testPNG(t))
+	p.tasks.add(domain.Task{ID: "t1", JobID: "j1", File: testFile("photo.png"), TargetFormat: "jpeg"})
+	p.tasks.add(domain.Task{ID: "t2", JobID: "j1", File: testFile("photo.png"), TargetFormat: "webp"})
+
+	p.run(t)
+	p.publish(t, "t1", "t2")
+	p.waitFor(t, func() bool { return p.tasks.allFinal() })
+
+	for _, task := range p.tasks.job("j1") {
+		if task.Status != domain.StatusCompleted {
+			t.Fatalf("task %s is %s (%s), want completed", task.ID, task.Status, task.ErrorMessage)
+		}
+		if task.Attempts != 1 {
+			t.Errorf("task %s took %d attempts, want 1", task.ID, task.Attempts)
+		}
+		if _, ok := p.files.get(task.ConvertedFileName); !ok {
+			t.Errorf("task %s result %q was not uploaded", task.ID, task.ConvertedFileName)
+		}
+	}
+
+	converted, _ := p.files.get(p.tasks.get("t1").ConvertedFileName)
+	if _, err := jpeg.Decode(bytes.NewReader(converted)); err != nil {
+		t.Errorf("converted file is not a JPEG: %v", err)
+	}
+
+	p.expectJobEvent(t, "j1", domain.WebhookJobCompleted)
+	p.expectDeadLetters(t, 0)
+}
+
+func TestPipelineFailsJob(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		// setup breaks the pipeline for task t1 of job j1
+		setup        func(p *pipeline)
+		wantStatus   domain.TaskStatus
+		wantError    string
+		wantAttempts int
+		wantEvent    domain.WebhookEvent
+		wantDead     int
+	}{
+		{
+			name:    "corrupt source",
+			retries: 2,
+			setup: func(p *pipeline) {
+				p.files.put("broken.png", []byte("not a png"))
+			},
+			wantStatus:   domain.StatusFailed,
+			wantError:    "conversion failed",
+			wantAttempts: 1,
+			wantEvent:    domain.WebhookJobFailed,
+		},
+		{
+			name:    "storage unavailable",
+			retries: 2,
+			setup: func(p *pipeline) {
+				p.files.failDownloads(errors.New("connection refused"))
+			},
+			wantStatus:   domain.StatusFailed,
+			wantError:    "failed to download source file",
+			wantAttempts: 3,
+			wantEvent:    domain.WebhookJobFailed,
+		},
+		{
+			name:    "database unavailable",
+			retries: 2,
+			setup: func(p *pipeline) {
+				p.tasks.failClaims(errors.New("connection refused"))
+			},
+			wantStatus: domain.StatusPending,
+			wantDead:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPipeline(t, tt.retries, time.Minute)
+			p.tasks.add(domain.Task{ID: "t1", JobID: "j1", File: testFile("broken.png"), TargetFormat: "jpeg"})
+			tt.setup(p)
+
+			p.run(t)
+			p.publish(t, "t1")
+			if tt.wantDead > 0 {
+				p.waitFor(t, func() bool { return len(p.mq.DeadLetters(testQueue)) == tt.wantDead })
+			} else {
+				p.waitFor(t, func() bool { return p.tasks.allFinal() })
+			}
+
+			task := p.tasks.get("t1")
+			if task.Status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", task.Status, tt.wantStatus)
+			}
+			if !strings.Contains(task.ErrorMessage, tt.wantError) {
+				t.Errorf("error = %q, want %q", task.ErrorMessage, tt.wantError)
+			}
+			if task.Attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", task.Attempts, tt.wantAttempts)
+			}
+			if tt.wantEvent != "" {
+				p.expectJobEvent(t, "j1", tt.wantEvent)
+			}
+			p.expectDeadLetters(t, tt.wantDead)
+		})
+	}
+}
+
+func TestPipelineWaitsForBusyTask(t *testing.T) {
+	// Any nack would dead-letter the message right away
+	p := newPipeline(t, 0, 100*time.Millisecond)
+	p.files.put("photo.png", testPNG(t))
+	p.tasks.add(domain.Task{ID: "t1", JobID: "j1", File: testFile("photo.png"), TargetFormat: "jpeg"})
+	p.tasks.hold("t1", "crashed-worker", 50*time.Millisecond)
+
+	p.run(t)
+	p.publish(t, "t1")
+	p.waitFor(t, func() bool { return p.tasks.allFinal() })
+
+	task := p.tasks.get("t1")
+	if task.Status != domain.StatusCompleted {
+		t.Fatalf("status = %s (%s), want completed", task.Status, task.ErrorMessage)
+	}
+	if task.Attempts != 2 || task.WorkerID != "worker-1" {
+		t.Errorf("attempt %d by %s, want attempt 2 taken over by worker-1", task.Attempts, task.WorkerID)
+	}
+	p.expectDeadLetters(t, 0)
+}
+
+// pipeline wires a task consumer to the in-memory broker, with tasks and
+// files kept in memory.
+type pipeline struct {
+	mq       *memory.Broker
+	tasks    *taskStore
+	files    *objectStore
+	consumer *TaskConsumer
+}
+
+func newPipeline(t *testing.T, retries int, lease time.Duration) *pipeline {
+	t.Helper()
+
+	tasks := &taskStore{tasks: make(map[string]*heldTask)}
+	files := &objectStore{objects: make(map[string][]byte)}
+	mq := memory.New(retries)
+	worker := app.NewWorkerService(tasks, files, noEvents{}, noCancels{}, "worker-1", lease)
+
+	queues := []TaskQueue{{Name: testQueue}}
+	opts := broker.SubscribeOptions{Concurrency: 2}
+
+	return &pipeline{
+		mq:       mq,
+		tasks:    tasks,
+		files:    files,
+		consumer: NewTaskConsumer(mq, queues, opts, worker, logger.NewLogger()),
+	}
+}
+
+// run consumes tasks until the test ends.
+func (p *pipeline) run(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.consumer.Run(ctx)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		p.mq.Close()
+	})
+}
+
+func (p *pipeline) publish(t *testing.T, taskIDs ...string) {
+	t.Helper()
+
+	for _, id := range taskIDs {
+		body, err := json.Marshal(domain.TaskMessage{TaskID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.mq.Publish(context.Background(), testQueue, broker.Message{Body: body}); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+}
+
+func (p *pipeline) waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pipeline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (p *pipeline) expectJobEvent(t *testing.T, jobID string, want domain.WebhookEvent) {
+	t.Helper()
+
+	payload, done := domain.NewJobWebhook(jobID, p.tasks.job(jobID))
+	if !done || payload.Event != want {
+		t.Errorf("job event = %q (done %v), want %q", payload.Event, done, want)
+	}
+}
+
+func (p *pipeline) expectDeadLetters(t *testing.T, want int) {
+	t.Helper()
+
+	if got := len(p.mq.DeadLetters(testQueue)); got != want {
+		t.Errorf("%d messages dead-lettered, want %d", got, want)
+	}
+}
+
+type heldTask struct {
+	domain.Task
+	lease      time.Duration
+	leaseUntil time.Time
+}
+
+// taskStore keeps tasks with the claim and lease rules of the Postgres
+// repository.
+type taskStore struct {
+	// Methods the worker does not use panic
+	domain.TaskRepository
+
+	mu       sync.Mutex
+	tasks    map[string]*heldTask
+	claimErr error
+}
+
+func (s *taskStore) add(task domain.Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	task.Status = domain.StatusPending
+	s.tasks[task.ID] = &heldTask{Task: task}
+}
+
+// hold claims the task for another worker until lease runs out.
+func (s *taskStore) hold(taskID, workerID string, lease time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.tasks[taskID]
+	t.Status = domain.StatusProcessing
+	t.Attempts++
+	t.WorkerID = workerID
+	t.lease = lease
+	t.leaseUntil = time.Now().Add(lease)
+}
+
+func (s *taskStore) failClaims(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.claimErr = err
+}
+
+func (s *taskStore) get(taskID string) domain.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tasks[taskID].Task
+}
+
+func (s *taskStore) job(jobID string) []domain.Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tasks []domain.Task
+	for _, t := range s.tasks {
+		if t.JobID == jobID {
+			tasks = append(tasks, t.Task)
+		}
+	}
+	return tasks
+}
+
+func (s *taskStore) allFinal() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tasks {
+		if !t.Status.IsFinal() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *taskStore) ClaimTask(_ context.Context, taskID, workerID string, lease time.Duration) (*domain.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.claimErr != nil {
+		return nil, s.claimErr
+	}
+
+	t := s.tasks[taskID]
+	switch {
+	case t.Status.IsFinal():
+		return nil, domain.ErrTaskFinished
+	case t.Status == domain.StatusProcessing && time.Now().Before(t.leaseUntil):
+		return nil, domain.ErrTaskBusy
+	}
+
+	t.Status = domain.StatusProcessing
+	t.Attempts++
+	t.WorkerID = workerID
+	t.StartedAt = time.Now()
+	t.lease = lease
+	t.leaseUntil = time.Now().Add(lease)
+
+	task := t.Task
+	return &task, nil
+}
+
+func (s *taskStore) RenewTaskLease(_ context.Context, task *domain.Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.current(task)
+	if err != nil {
+		return err
+	}
+	t.leaseUntil = time.Now().Add(t.lease)
+	return nil
+}
+
+func (s *taskStore) UpdateTaskStatus(_ context.Context, task *domain.Task) (*domain.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.current(task)
+	if err != nil {
+		return nil, err
+	}
+	t.Task = *task
+
+	updated := t.Task
+	return &updated, nil
+}
+
+func (s *taskStore) RequeueTask(_ context.Context, task *domain.Task, reason string) (*domain.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.current(task)
+	if err != nil {
+		return nil, err
+	}
+	t.Status = domain.StatusPending
+	t.ErrorMessage = reason
+
+	requeued := t.Task
+	return &requeued, nil
+}
+
+// current returns the stored task if task is its current attempt.
+func (s *taskStore) current(task *domain.Task) (*heldTask, error) {
+	t := s.tasks[task.ID]
+	if t.Status != domain.StatusProcessing || t.Attempts != task.Attempts {
+		return nil, domain.ErrTaskCancelled
+	}
+	return t, nil
+}
+
+// objectStore stands in for object storage.
+type objectStore struct {
+	// Methods the worker does not use panic
+	app.FileService
+
+	mu          sync.Mutex
+	objects     map[string][]byte
+	downloadErr error
+}
+
+func (s *objectStore) put(name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[name] = data
+}
+
+func (s *objectStore) get(name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.objects[name]
+	return data, ok
+}
+
+func (s *objectStore) failDownloads(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.downloadErr = err
+}
+
+func (s *objectStore) DownloadFile(_ context.Context, objectName, downloadPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.downloadErr != nil {
+		return s.downloadErr
+	}
+	data, ok := s.objects[objectName]
+	if !ok {
+		return errors.New("object not found")
+	}
+	return os.WriteFile(downloadPath, data, 0o600)
+}
+
+func (s *objectStore) UploadFile(_ context.Context, objectName, filePath, _ string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	s.put(objectName, data)
+	return nil
+}
+
+type noEvents struct{}
+
+func (noEvents) PublishTaskEvent(context.Context, domain.TaskEvent) error { return nil }
+
+type noCancels struct{}
+
+func (noCancels) WatchTaskCancellation(ctx context.Context, _ string) (context.Context, context.CancelFunc) {
+	return context.WithCancel(ctx)
+}
+
+func testFile(objectName string) domain.File {
+	return domain.File{ObjectName: objectName, OriginalName: objectName, OriginalFormat: "png"}
+}
+
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.Set(3, 4, color.NRGBA{R: 200, A: 255})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,12 @@
+package internal
+
+import (
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/infra"
+)
+
+func InitOutboxRelay(config *core.AppConfig, log logger.Log, db core.Database, mq broker.Broker) *infra.OutboxRelay {
+	return infra.NewOutboxRelay(db, mq, config.Outbox, log)
+}
@@ -0,0 +1,17 @@
+package internal
+
+import (
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/lib/hashids"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/infra"
+)
+
+func InitWebhookDispatcher(config *core.AppConfig, log logger.Log, db core.Database) *infra.WebhookDispatcher {
+	hd, err := hashids.NewHashIDService(config.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to register hashids service: %v", err)
+	}
+
+	return infra.NewWebhookDispatcher(db, hd, config.Webhook, log)
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"os"
+	"slices"
+	"strconv"
+
+	"github.com/meraf00/swytch/core"
+	"github.com/meraf00/swytch/core/broker"
+	"github.com/meraf00/swytch/core/lib/hashids"
+	"github.com/meraf00/swytch/core/lib/logger"
+	"github.com/meraf00/swytch/internal/pipeline/app"
+	"github.com/meraf00/swytch/internal/pipeline/domain"
+	"github.com/meraf00/swytch/internal/pipeline/infra"
+	consumer "github.com/meraf00/swytch/internal/pipeline/interfaces/queue"
+	"github.com/redis/go-redis/v9"
+)
+
+func InitWorker(config *core.AppConfig, log logger.Log, db core.Database, rdb *redis.Client, mq broker.Broker) (*consumer.TaskConsumer, *infra.TaskCancellationsRedis) {
+	// Core
+	hd, err := hashids.NewHashIDService(config.Encryption)
+	if err != nil {
+		log.Fatalf("Failed to register hashids service: %v", err)
+	}
+
+	// Repositories
+	taskRepo := infra.NewTaskRepositoryPG(db, hd, config.Broker.TaskQueue)
+	taskEvents := infra.NewTaskEventsRedis(rdb, log)
+	taskCancellations := infra.NewTaskCancellationsRedis(rdb, log)
+
+	// Services
+	fileService, err := infra.NewMinioFileService(&config.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initiate minio service: %v", err)
+	}
+	workerService := app.NewWorkerService(taskRepo, fileService, taskEvents, taskCancellations, workerID(), config.Broker.TaskLease)
+
+	// Queue Surface
+	opts := broker.SubscribeOptions{
+		Concurrency: config.Broker.Concurrency,
+		Prefetch:    config.Broker.Prefetch,
+	}
+
+	return consumer.NewTaskConsumer(mq, taskQueues(config, log), opts, workerService, log), taskCancellations
+}
+
+// taskQueues returns the queues of the converter classes and priority lanes
+// this worker takes tasks of, ranked by lane.
+func taskQueues(config *core.AppConfig, log logger.Log) []consumer.TaskQueue {
+	available := domain.ConverterClasses()
+
+	classes := config.Broker.Classes
+	if len(classes) == 0 {
+		classes = available
+	}
+
+	lanes := domain.JobPriorities()
+	if len(config.Broker.Lanes) > 0 {
+		lanes = nil
+		for _, lane := range config.Broker.Lanes {
+			priority := domain.JobPriority(lane)
+			if !slices.Contains(domain.JobPriorities(), priority) {
+				log.Fatalf("Unknown priority lane %q, expected one of %v", lane, domain.JobPriorities())
+			}
+			lanes = append(lanes, priority)
+		}
+	}
+
+	var queues []consumer.TaskQueue
+	for _, class := range classes {
+		if !slices.Contains(available, class) {
+			log.Fatalf("Unknown converter class %q, expected one of %v", class, available)
+		}
+		for _, lane := range lanes {
+			queues = append(queues, consumer.TaskQueue{
+				Name: infra.TaskQueue(config.Broker.TaskQueue, class, lane),
+				Rank: slices.Index(domain.JobPriorities(), lane),
+			})
+		}
+	}
+	return queues
+}
+
+// workerID names this process in task attempts.
+func workerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + ":" + strconv.Itoa(os.Getpid())
+}